@@ -0,0 +1,211 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How bad an alert is. Severities can be compared, a critical alert is more
+// severe than a warning.
+type Severity int
+
+// The severities, from none at all to critical.
+const (
+	SEVERITY_NONE Severity = iota
+	SEVERITY_INFO
+	SEVERITY_WARNING
+	SEVERITY_CRITICAL
+)
+
+// Defaults for the severity of alerts, when none are configured.
+const (
+	defaultDiskCritical        = 97
+	defaultFailedLoginWarning  = 100
+	defaultFailedLoginCritical = 1000
+)
+
+// Returns the name of the severity, like `warning'.
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_INFO:
+		return "info"
+	case SEVERITY_WARNING:
+		return "warning"
+	case SEVERITY_CRITICAL:
+		return "critical"
+	}
+
+	return "none"
+}
+
+// Returns the color alerts of this severity are shown in.
+func (s Severity) Color() string {
+	switch s {
+	case SEVERITY_WARNING:
+		return "darkorange"
+	case SEVERITY_CRITICAL:
+		return "red"
+	}
+
+	return "steelblue"
+}
+
+// Parses the name of a severity, like `warning'.
+func ParseSeverity(name string) (Severity, error) {
+	for s := SEVERITY_NONE; s <= SEVERITY_CRITICAL; s++ {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+
+	return SEVERITY_NONE, fmt.Errorf("Unknown severity `%s'", name)
+}
+
+// Encodes the severity by its name, like `warning', so it's readable in JSON
+// and configuration files.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Decodes a severity from its name, see ParseSeverity.
+func (s *Severity) UnmarshalText(text []byte) error {
+	severity, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = severity
+
+	return nil
+}
+
+// Something noteworthy in a report, like a disk filling up.
+type Alert struct {
+	Severity Severity `json:"severity"`
+	// What the alert is about, like disk or swap
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// Returns a simple string representation of this struct.
+func (a Alert) String() string {
+	return fmt.Sprintf("[%s] %s: %s", a.Severity, a.Category, a.Message)
+}
+
+// The thresholds which decide how severe an alert is, next to the thresholds
+// in the report which decide whether there's an alert at all.
+type AlertLimits struct {
+	// Disk or inode usage percentage from which a disk alert is critical
+	DiskCritical int `setting:"DiskCriticalThreshold"`
+	// Amount of failed logins from which they are a warning, or critical,
+	// zero to never. Below that, failed logins from new IP addresses are
+	// informational.
+	FailedLoginWarning  int `setting:"FailedLoginWarning"`
+	FailedLoginCritical int `setting:"FailedLoginCritical"`
+}
+
+// Collects the alerts in the report, the most severe first. Every disk over
+// the threshold and every failed unit is an alert of its own.
+func BuildAlerts(r *ReportData, limits AlertLimits) []Alert {
+	alerts := make([]Alert, 0)
+	add := func(severity Severity, category string, format string, a ...interface{}) {
+		alerts = append(alerts, Alert{severity, category, fmt.Sprintf(format, a...)})
+	}
+
+	for _, fs := range r.DiskAlerts {
+		severity := SEVERITY_WARNING
+		if fs.UsePercent >= limits.DiskCritical || fs.IUsePercent >= limits.DiskCritical {
+			severity = SEVERITY_CRITICAL
+		}
+		msg := fmt.Sprintf("%s (%s) is %s full, %s available", fs.MountPoint, fs.FileSystem, fs.UsePercentage, fs.Avail)
+		if fs.IUsePercentage != "" {
+			msg += fmt.Sprintf(", %s of inodes used", fs.IUsePercentage)
+		}
+		add(severity, "disk", "%s", msg)
+	}
+	if r.HasSwapAlert {
+		add(SEVERITY_WARNING, "swap", "%.0f%% used, over %d%%", r.Memory.SwapUsedPercentage(), r.SwapThreshold)
+	}
+	if r.HasClockAlert {
+		if r.Clock.Synchronized {
+			add(SEVERITY_WARNING, "clock", "off by %s, over %s", r.Clock.Offset, r.ClockOffsetThreshold)
+		} else {
+			add(SEVERITY_WARNING, "clock", "not synchronized with NTP")
+		}
+	}
+	// a failing disk is about to lose data, so it's critical right away.
+	for _, disk := range r.SmartDisks {
+		switch {
+		case !disk.Passed:
+			add(SEVERITY_CRITICAL, "smart", "%s failed its health check (%s)", disk.Device, disk.Health)
+		case disk.ReallocatedSectors > 0:
+			add(SEVERITY_CRITICAL, "smart", "%s has %d reallocated sectors", disk.Device, disk.ReallocatedSectors)
+		case disk.PendingSectors > 0:
+			add(SEVERITY_WARNING, "smart", "%s has %d pending sectors", disk.Device, disk.PendingSectors)
+		}
+	}
+	if r.HasTempAlert {
+		add(SEVERITY_WARNING, "temperature", "%.1f °C (%s), over %d °C", r.Hottest.Celsius, r.Hottest.Type, r.TempThreshold)
+	}
+	if r.RecentlyRebooted {
+		add(SEVERITY_WARNING, "reboot", "rebooted recently, at %s", r.BootTime.Format("2006-01-02 15:04:05"))
+	}
+	if r.HasReportGap {
+		add(SEVERITY_WARNING, "report", "the previous report was %s ago, at %s; the box may have been down",
+			FormatDuration(r.SincePreviousReport()), r.PreviousReport.Format("2006-01-02 15:04:05"))
+	}
+	if r.ExtIpChanged {
+		add(SEVERITY_WARNING, "ip", "changed from %s to %s", r.PreviousExtIp, r.ExtIp)
+	}
+	for _, unit := range r.FailedUnits {
+		msg := fmt.Sprintf("%s (%s)", unit.Name, unit.SubState)
+		if unit.Description != "" {
+			msg += ": " + unit.Description
+		}
+		add(SEVERITY_CRITICAL, "systemd", "%s", msg)
+	}
+	for _, p := range r.Respawns {
+		if p.CrashLoop {
+			add(SEVERITY_WARNING, "processes", "%s started %d times in the last %s; it may be crash looping",
+				p.Name, len(p.Starts), FormatDuration(r.RespawnWindow))
+		}
+	}
+	if r.HasSecurityUpdates() {
+		add(SEVERITY_WARNING, "updates", "%s", r.Updates)
+	}
+	if r.UnfamiliarLogins > 0 {
+		add(SEVERITY_CRITICAL, "logins", "%d login(s) from unfamiliar hosts since the previous report", r.UnfamiliarLogins)
+	}
+	if r.UnexpectedPorts > 0 {
+		add(SEVERITY_WARNING, "sockets", "%d socket(s) listening on a port which is not allowed", r.UnexpectedPorts)
+	}
+
+	// lots of failed logins are worth an alert, even from known addresses.
+	total := 0
+	for _, f := range r.Failures {
+		total += f.Failures
+	}
+	severity := SEVERITY_NONE
+	switch {
+	case limits.FailedLoginCritical > 0 && total >= limits.FailedLoginCritical:
+		severity = SEVERITY_CRITICAL
+	case limits.FailedLoginWarning > 0 && total >= limits.FailedLoginWarning:
+		severity = SEVERITY_WARNING
+	case r.NewFailureCount > 0:
+		severity = SEVERITY_INFO
+	}
+	if severity != SEVERITY_NONE {
+		add(severity, "failed logins", "%d from %d IP address(es), %d new since the previous report", total, len(r.Failures), r.NewFailureCount)
+	}
+	if r.HasLoginSpike {
+		add(SEVERITY_WARNING, "failed logins", "%d in the last %s, over %d; a brute-force attack may be going on",
+			r.FailedLoginRate, FormatDuration(r.FailedLoginRateWindow), r.FailedLoginRateThreshold)
+	}
+
+	// the order above is kept within a severity.
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Severity > alerts[j].Severity
+	})
+
+	return alerts
+}
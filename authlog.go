@@ -0,0 +1,571 @@
+package stats
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Longest line in the auth log, or the fail2ban log, which can be parsed.
+const maxAuthLogLine = 1024 * 1024
+
+// Defaults for finding the failed logins.
+var (
+	// Patterns matching failed logins. Every pattern must have an `ip' group,
+	// and may have a `user' group. A single failed attempt may be logged on
+	// several lines (e.g. by both sshd and PAM), which are told apart by the
+	// pid of sshd: the lines of a connection count as often as the pattern
+	// which matched most of them, not once per line, see authAttempts. Lines
+	// without a pid are each counted.
+	defaultAuthPatterns = []string{
+		`Failed password for (?P<user>.*) from (?P<ip>.*) port`,
+		`Invalid user (?P<user>.*) from (?P<ip>\S+)`,
+		`authentication failure;.* rhost=(?P<ip>\S+)(?:\s+user=(?P<user>\S+))?`,
+	}
+
+	defaultAuthLog          = "/var/log/auth.log"
+	defaultAuthJournalUnits = []string{"ssh", "sshd"}
+	defaultAuthJournalSince = "24 hours ago"
+
+	// the recent failed logins are counted over this window, and more than
+	// the threshold of them is a spike
+	defaultFailedLoginRateWindow    = time.Hour
+	defaultFailedLoginRateThreshold = 60
+)
+
+// Representation of an authentication failure.
+type AuthFailure struct {
+	// The ip address (IPv6 or IPv4) that failed
+	IPAddress string `json:"ip_address"`
+	// Amount of attempted logins
+	Failures int `json:"failures"`
+	// Amount of attempted logins within the rate window, see
+	// AuthLogSource.RateWindow
+	Recent int `json:"recent"`
+	// The attempted usernames, and the amount of attempts for each
+	Usernames map[string]int `json:"usernames"`
+	// Location of the IP address, when GeoIP lookups are enabled
+	Country string `json:"country"`
+	City    string `json:"city"`
+	// Host name of the IP address, when reverse DNS lookups are enabled
+	PTR string `json:"ptr"`
+	// Whether the IP address did not fail in the previous reports
+	IsNew bool `json:"is_new"`
+}
+
+// Returns a simple string representation of this struct.
+func (a AuthFailure) String() string {
+	return fmt.Sprintf("%s (%d)", a.IPAddress, a.Failures)
+}
+
+// Returns the username which was attempted most often from this IP address.
+// Ties are broken alphabetically, so the result is stable.
+func (a AuthFailure) TopUsername() string {
+	top, topCount := "", 0
+	for name, count := range a.Usernames {
+		if count > topCount || (count == topCount && name < top) {
+			top, topCount = name, count
+		}
+	}
+
+	return top
+}
+
+// A list type definition for AuthFailure. Used to implement the sort.Interface to enable
+// the sorting of this list via sort.Sort().
+type AuthFailures []AuthFailure
+
+// Returns the length of this slice/list by returning len(self)
+func (a AuthFailures) Len() int {
+	return len(a)
+}
+
+// Swaps elements.
+func (a AuthFailures) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+// Returns whether an IP address is 'less' than the other ip address: it has
+// more failures, or as many and sorts before it, so the order is stable.
+func (a AuthFailures) Less(i, j int) bool {
+	if a[i].Failures != a[j].Failures {
+		return a[i].Failures > a[j].Failures
+	}
+	return a[i].IPAddress < a[j].IPAddress
+}
+
+// Where to read the failed logins from. The log file is preferred, but on
+// systemd-only distributions it may not exist, in which case the journal of
+// the given units is read instead.
+type AuthLogSource struct {
+	// Path to the auth log, like /var/log/auth.log
+	LogFile string `setting:"AuthLog"`
+	// The systemd units to read from the journal, like ssh and sshd. When
+	// empty, the journal is never read.
+	JournalUnits []string `setting:"AuthJournalUnits"`
+	// How far back to read the journal, in a format understood by the
+	// --since flag of journalctl, like `24 hours ago'.
+	JournalSince string `setting:"AuthJournalSince"`
+	// Whether to read the rotated logs too, like auth.log.1 and auth.log.2.gz
+	Rotated bool `setting:"AuthLogRotated"`
+	// Only count failed logins within this window. Zero means no limit.
+	Window time.Duration `setting:"AuthLogWindow"`
+	// Failed logins within this window are recent, and count towards the
+	// rate. Zero means none are.
+	RateWindow time.Duration `setting:"FailedLoginRateWindow"`
+	// Additional patterns matching failed logins, next to the defaults. In
+	// the settings every setting starting with AuthLogPattern is one.
+	Patterns []string
+	// IP addresses and CIDR ranges whose failed logins are ignored, like
+	// your own, or scanners you've given up on
+	IgnoreIPs []string `setting:"AuthIgnoreIPs"`
+}
+
+// Returns the additional patterns matching failed logins from the settings.
+// Regular expressions may contain commas, so instead of a list every setting
+// starting with AuthLogPattern adds a pattern.
+func authPatterns(settings map[string]string) []string {
+	patterns := make([]string, 0)
+	for key, val := range settings {
+		if strings.HasPrefix(key, SETTING_AUTH_PATTERN) && strings.TrimSpace(val) != "" {
+			patterns = append(patterns, val)
+		}
+	}
+	sort.Strings(patterns)
+
+	return patterns
+}
+
+// Opens the auth log for reading. When the log file does not exist, and
+// journal units are configured, the output of journalctl is returned instead.
+// Its default output format is identical to the syslog format of auth.log.
+func (src AuthLogSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	file, err := os.Open(src.LogFile)
+	if err == nil {
+		return file, nil
+	}
+	if !os.IsNotExist(err) || len(src.JournalUnits) == 0 {
+		return nil, logOpenError(src.LogFile, err)
+	}
+
+	args := []string{"--quiet", "--no-pager", "--since", src.JournalSince}
+	for _, unit := range src.JournalUnits {
+		args = append(args, "-u", unit)
+	}
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	cmd.WaitDelay = killWaitDelay
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("`%s' does not exist, and reading the journal failed: %s", src.LogFile, err)
+	}
+
+	return &journalReader{out, cmd}, nil
+}
+
+// Returns the error for an auth log which couldn't be opened. Most
+// distributions only let root and the adm group read the auth log, so when
+// permission is denied, the error tells how to fix that.
+func logOpenError(file string, err error) error {
+	if os.IsPermission(err) {
+		return fmt.Errorf("Permission denied reading `%s': add your user to the `adm' group or run as root", file)
+	}
+
+	return fmt.Errorf("Unable to read `%s': %s", file, err)
+}
+
+// Returns the rotated logs of the log file, like auth.log.1 and auth.log.2.gz.
+func (src AuthLogSource) RotatedFiles() ([]string, error) {
+	return filepath.Glob(src.LogFile + ".*")
+}
+
+// Opens a rotated log file for reading, transparently decompressing it when
+// it's gzipped.
+func openRotatedLog(file string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, logOpenError(file, err)
+	}
+	if !strings.HasSuffix(file, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Unable to decompress `%s': %s", file, err)
+	}
+
+	return &gzipFile{gz, f}, nil
+}
+
+// A gzipped file, closing it closes both the decompressor and the file.
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Closes the decompressor and the file.
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// Streams the output of journalctl. Closing it waits for journalctl to exit,
+// and reports its failure if it did not exit cleanly.
+type journalReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+// Closes the output, and waits for journalctl to exit.
+func (j *journalReader) Close() error {
+	j.ReadCloser.Close()
+	if err := j.cmd.Wait(); err != nil {
+		return fmt.Errorf("Reading the journal failed: %s", err)
+	}
+
+	return nil
+}
+
+// This function analyzes the auth log for failed login attempts. It will
+// return a list of AuthFailures, one per IP address, with the total amount of
+// failed logins, sorted by the amount of failures. When configured, the
+// rotated logs are analyzed too, and the failures of all logs are summed.
+// When an error occurs, the returned list will be nil. When a-okay, the list
+// will be non-nil, but the error will be.
+func AnalyzeAuthLog(ctx context.Context, src AuthLogSource) ([]AuthFailure, error) {
+	now := time.Now()
+	var since, recent time.Time
+	if src.Window > 0 {
+		since = now.Add(-src.Window)
+	}
+	if src.RateWindow > 0 {
+		recent = now.Add(-src.RateWindow)
+	}
+
+	rexes, err := compileAuthPatterns(defaultAuthPatterns)
+	if err != nil {
+		return nil, err
+	}
+	custom, err := compileAuthPatterns(src.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	rexes = append(rexes, custom...)
+	ignored, err := parseIPNets(src.IgnoreIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	// map with ip addresses, and their failed logins
+	ipMap := make(map[string]*AuthFailure)
+
+	authlog, err := src.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = parseAuthFailures(authlog, rexes, ipMap, since, recent)
+	if cerr := authlog.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if src.Rotated {
+		rotated, err := src.RotatedFiles()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range rotated {
+			authlog, err := openRotatedLog(file)
+			if err != nil {
+				return nil, err
+			}
+			err = parseAuthFailures(authlog, rexes, ipMap, since, recent)
+			authlog.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// iterate of the map in the end, add them to a list so we
+	// can actually sort them.
+	listfails := make(AuthFailures, 0)
+	for _, v := range ipMap {
+		if !containsIP(ignored, v.IPAddress) {
+			listfails = append(listfails, *v)
+		}
+	}
+
+	sort.Sort(listfails)
+	return listfails, nil
+}
+
+// Returns the IP address in its canonical form, so every way of writing an
+// address counts as the same address: IPv6 in lower case and compressed, like
+// 2001:db8::1, without brackets or zone, and IPv4-mapped IPv6 addresses like
+// ::ffff:192.0.2.7 as plain IPv4. Anything else, like a host name in the
+// rhost of PAM, is returned as is.
+func normalizeIP(address string) string {
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"))
+	if err != nil {
+		return address
+	}
+
+	return addr.Unmap().WithZone("").String()
+}
+
+// Parses IP addresses and CIDR ranges, like 192.0.2.7 or 2001:db8::/32. A
+// single address is a range of just that address.
+func parseIPNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if _, ipnet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipnet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IP address or CIDR range `%s'", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return nets, nil
+}
+
+// Returns whether the address is in one of the ranges. Addresses which aren't
+// IP addresses, like host names, are in none of them.
+func containsIP(nets []*net.IPNet, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The compiled patterns matching failed logins, by pattern. The auth log is
+// analyzed for every report, which in serve mode is over and over, so every
+// pattern is only compiled once.
+var authRexes sync.Map
+
+// Compiles the patterns matching failed logins, checking that they all have
+// an `ip' group to get the IP address from. Patterns which were compiled
+// before are taken from authRexes.
+func compileAuthPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	rexes := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if rex, ok := authRexes.Load(pattern); ok {
+			rexes = append(rexes, rex.(*regexp.Regexp))
+			continue
+		}
+
+		rex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compile regular expression `%s': %s", pattern, err)
+		}
+		if rex.SubexpIndex("ip") < 0 {
+			return nil, fmt.Errorf("Regular expression `%s' has no `ip' group", pattern)
+		}
+		authRexes.Store(pattern, rex)
+		rexes = append(rexes, rex)
+	}
+
+	return rexes, nil
+}
+
+// Amount of connections authAttempts remembers, before it forgets the older
+// half of them.
+const maxAuthAttempts = 4096
+
+// Tells which lines of the auth log are about a failed login already counted.
+// sshd logs a single failed attempt more than once: an unknown user with a
+// wrong password is logged as an invalid user, as a PAM authentication
+// failure and as a failed password. The lines of a connection have the pid of
+// its sshd process, so per pid and address, every pattern is counted, and the
+// connection counts as many failed logins as the pattern which matched most.
+// Connections are short lived, so only the recent ones are remembered.
+type authAttempts struct {
+	current, previous map[string]*authAttempt
+}
+
+// The lines of a single connection.
+type authAttempt struct {
+	// the lines by pattern, and the most of them
+	matches []int
+	max     int
+	// the username of the connection, as not every line has one
+	username string
+}
+
+// Records a line matching the pattern, and returns whether it's another
+// failed login, and the username of the connection. Lines without a pid are
+// always another failed login.
+func (a *authAttempts) add(pid, ip string, pattern, patterns int, username string) (bool, string) {
+	if pid == "" {
+		return true, username
+	}
+
+	key := pid + " " + ip
+	attempt, ok := a.current[key]
+	if !ok {
+		if attempt, ok = a.previous[key]; !ok {
+			attempt = &authAttempt{matches: make([]int, patterns)}
+		}
+		if len(a.current) >= maxAuthAttempts/2 {
+			a.previous, a.current = a.current, make(map[string]*authAttempt)
+		}
+		a.current[key] = attempt
+	}
+
+	if username != "" {
+		attempt.username = username
+	}
+	attempt.matches[pattern]++
+	if attempt.matches[pattern] <= attempt.max {
+		return false, attempt.username
+	}
+	attempt.max++
+
+	return true, attempt.username
+}
+
+// Returns the pid of the process which logged the syslog line, like 1234 of
+// `sshd[1234]: ...', or an empty string without one.
+func linePid(line string) string {
+	end := strings.Index(line, "]: ")
+	if end < 0 {
+		return ""
+	}
+	start := strings.LastIndexByte(line[:end], '[')
+	if start < 0 {
+		return ""
+	}
+	pid := line[start+1 : end]
+	if _, err := strconv.Atoi(pid); err != nil {
+		return ""
+	}
+
+	return pid
+}
+
+// Parses the failed login attempts from the lines of an auth log, adding them
+// to the given map of ip addresses and their failed logins. A line is a failed
+// login when it matches any of the regular expressions, unless it's about an
+// attempt which was counted already, see authAttempts. Lines logged before
+// since are skipped, unless since is zero. Lines logged after recent are
+// counted as recent too, unless recent is zero; lines without a timestamp
+// never are. The log is scanned line by line, so even huge logs don't have
+// to fit in memory.
+func parseAuthFailures(r io.Reader, rexes []*regexp.Regexp, ipMap map[string]*AuthFailure, since, recent time.Time) error {
+	now := time.Now()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAuthLogLine)
+	attempts := &authAttempts{current: make(map[string]*authAttempt)}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		for i, rex := range rexes {
+			var what []string = rex.FindStringSubmatch(line)
+			if what == nil {
+				continue
+			}
+			isRecent := false
+			if !since.IsZero() || !recent.IsZero() {
+				t, ok := parseSyslogTime(line, now)
+				if ok && !since.IsZero() && t.Before(since) {
+					break
+				}
+				isRecent = ok && !recent.IsZero() && !t.Before(recent)
+			}
+
+			ipAddress := normalizeIP(what[rex.SubexpIndex("ip")])
+			var username string
+			if idx := rex.SubexpIndex("user"); idx >= 0 {
+				// sshd logs unknown users as `invalid user foo'.
+				username = strings.TrimPrefix(what[idx], "invalid user ")
+			}
+			another, username := attempts.add(linePid(line), ipAddress, i, len(rexes), username)
+			if !another {
+				break
+			}
+			// if not in the map, start counting for this IP
+			failure, ok := ipMap[ipAddress]
+			if !ok {
+				failure = &AuthFailure{IPAddress: ipAddress, Usernames: make(map[string]int)}
+				ipMap[ipAddress] = failure
+			}
+			failure.Failures += 1
+			if isRecent {
+				failure.Recent += 1
+			}
+			if username != "" {
+				failure.Usernames[username] += 1
+			}
+			// a line counts once, even when several patterns match.
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Unable to read auth log: %s", err)
+	}
+
+	return nil
+}
+
+// Parses the timestamp at the start of a syslog line. Both the traditional
+// format (`Jan 15 10:23:45') and the RFC 3339 format of newer rsyslog setups
+// are understood. The traditional format has no year, so the year is taken
+// from now, unless that places the line in the future (i.e. it was logged
+// last year). Returns false when there is no timestamp.
+func parseSyslogTime(line string, now time.Time) (time.Time, bool) {
+	if len(line) >= 15 {
+		t, err := time.ParseInLocation("Jan _2 15:04:05", line[:15], time.Local)
+		if err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			return t, true
+		}
+	}
+
+	if fld := strings.Fields(line); len(fld) > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, fld[0]); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
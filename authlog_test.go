@@ -0,0 +1,269 @@
+package stats
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Writes an auth log to a temporary file, and returns its path.
+func writeAuthLog(t testing.TB, lines ...string) string {
+	file := filepath.Join(t.TempDir(), "auth.log")
+	if err := ioutil.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// Returns the failures by IP address.
+func failuresByIP(failures []AuthFailure) map[string]int {
+	byIP := make(map[string]int, len(failures))
+	for _, f := range failures {
+		byIP[f.IPAddress] = f.Failures
+	}
+
+	return byIP
+}
+
+// A large auth log is scanned line by line: the counts are right, and the
+// memory in use doesn't grow with the size of the log.
+func TestAnalyzeAuthLogLarge(t *testing.T) {
+	const ips, attempts = 100, 2000
+
+	file := filepath.Join(t.TempDir(), "auth.log")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < ips*attempts; i++ {
+		fmt.Fprintf(w, "Jan 15 10:23:45 box sshd[%d]: Failed password for root from 198.51.100.%d port 22 ssh2\n", i, i%ips)
+		fmt.Fprintf(w, "Jan 15 10:23:45 box sshd[%d]: Accepted publickey for me from 192.0.2.1 port 22 ssh2\n", i)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	failures, err := AnalyzeAuthLog(context.Background(), AuthLogSource{LogFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+
+	if len(failures) != ips {
+		t.Fatalf("expected %d addresses, got %d", ips, len(failures))
+	}
+	for _, f := range failures {
+		if f.Failures != attempts || f.Usernames["root"] != attempts {
+			t.Errorf("%s: expected %d failures for root, got %d (%v)", f.IPAddress, attempts, f.Failures, f.Usernames)
+		}
+	}
+	// the heap obtained from the OS is bounded by a few lines of the longest
+	// length and what's kept per address, not by the size of the log. The
+	// race detector adds its own overhead, which has nothing to do with that.
+	if raceEnabled {
+		t.Log("not checking the heap with the race detector on")
+		return
+	}
+	budget := uint64(8*maxAuthLogLine + ips*4096)
+	if after.HeapSys > before.HeapSys {
+		if grown := after.HeapSys - before.HeapSys; grown > budget {
+			t.Errorf("heap grew by %s for a log of %s, expected at most %s", formatBytes(grown), formatBytes(uint64(fi.Size())), formatBytes(budget))
+		}
+	}
+}
+
+// An auth log which can't be read for lack of permission tells how to fix
+// that.
+func TestAnalyzeAuthLogPermissionDenied(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "auth.log")
+	if err := ioutil.WriteFile(file, []byte("Failed password for root from 192.0.2.1 port 22 ssh2\n"), 0000); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := os.Open(file); err == nil {
+		f.Close()
+		t.Skip("the permissions aren't enforced, like for root")
+	}
+
+	_, err := AnalyzeAuthLog(context.Background(), AuthLogSource{LogFile: file})
+	if err == nil {
+		t.Fatal("expected an error for an unreadable auth log")
+	}
+	if !strings.Contains(err.Error(), "adm") || !strings.Contains(err.Error(), file) {
+		t.Errorf("expected the adm group and the file in the error, got %s", err)
+	}
+}
+
+func TestLogOpenError(t *testing.T) {
+	err := logOpenError("/var/log/auth.log", &os.PathError{Op: "open", Path: "/var/log/auth.log", Err: os.ErrPermission})
+	if !strings.Contains(err.Error(), "add your user to the `adm' group or run as root") {
+		t.Errorf("expected how to fix the permissions, got %s", err)
+	}
+
+	err = logOpenError("/var/log/auth.log", &os.PathError{Op: "open", Path: "/var/log/auth.log", Err: os.ErrNotExist})
+	if strings.Contains(err.Error(), "adm") {
+		t.Errorf("expected no advice about permissions for a missing file, got %s", err)
+	}
+}
+
+// The patterns are only compiled once, after that getting them only
+// allocates the slice they're returned in.
+func TestCompileAuthPatternsCached(t *testing.T) {
+	if _, err := compileAuthPatterns(defaultAuthPatterns); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		compileAuthPatterns(defaultAuthPatterns)
+	})
+	if allocs > 1 {
+		t.Errorf("expected at most 1 allocation per call, got %.0f", allocs)
+	}
+}
+
+// Compares getting the compiled patterns with compiling them on every call,
+// like AnalyzeAuthLog used to.
+func BenchmarkCompileAuthPatterns(b *testing.B) {
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := compileAuthPatterns(defaultAuthPatterns); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, pattern := range defaultAuthPatterns {
+				regexp.MustCompile(pattern)
+			}
+		}
+	})
+}
+
+// The ignored addresses and ranges, IPv4 and IPv6 alike, are left out of the
+// failures.
+func TestAnalyzeAuthLogIgnoreIPs(t *testing.T) {
+	file := writeAuthLog(t,
+		"Jan 15 10:23:45 box sshd[1]: Failed password for root from 192.0.2.7 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[2]: Failed password for root from 192.0.2.8 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[3]: Failed password for root from 198.51.100.42 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[4]: Failed password for root from ::ffff:198.51.100.43 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[5]: Failed password for root from 203.0.113.1 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[6]: Failed password for root from 2001:db8:1:2::3 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[7]: Failed password for root from 2001:db8::5 port 22 ssh2",
+		"Jan 15 10:23:45 box sshd[8]: Failed password for root from 2001:db8::6 port 22 ssh2",
+	)
+	src := AuthLogSource{
+		LogFile:   file,
+		IgnoreIPs: []string{"192.0.2.7", "198.51.100.0/24", "2001:db8:1::/48", "2001:DB8::5"},
+	}
+
+	failures, err := AnalyzeAuthLog(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"192.0.2.8": 1, "203.0.113.1": 1, "2001:db8::6": 1}
+	if got := failuresByIP(failures); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	src.IgnoreIPs = []string{"192.0.2.0/33"}
+	if _, err := AnalyzeAuthLog(context.Background(), src); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+}
+
+// IPv6 addresses are counted per address however they're written, and
+// IPv4-mapped addresses count as their IPv4 address.
+func TestAnalyzeAuthLogIPv6(t *testing.T) {
+	file := writeAuthLog(t,
+		"Jan 15 10:23:45 box sshd[1]: Failed password for root from 2001:db8::1 port 22 ssh2",
+		"Jan 15 10:23:46 box sshd[2]: Failed password for invalid user admin from 2001:DB8:0:0::1 port 51234 ssh2",
+		"Jan 15 10:23:47 box sshd[3]: Failed password for root from fe80::1%eth0 port 22 ssh2",
+		"Jan 15 10:23:48 box sshd[4]: Failed password for root from ::ffff:192.0.2.7 port 22 ssh2",
+		"Jan 15 10:23:49 box sshd[5]: Failed password for pi from 192.0.2.7 port 22 ssh2",
+		"2024-01-15T10:23:50.123456+01:00 box sshd[6]: Failed password for root from 2001:db8:0:1::ab port 22 ssh2",
+	)
+
+	failures, err := AnalyzeAuthLog(context.Background(), AuthLogSource{LogFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"2001:db8::1": 2, "fe80::1": 1, "192.0.2.7": 2, "2001:db8:0:1::ab": 1}
+	if got := failuresByIP(failures); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	for _, f := range failures {
+		if f.IPAddress == "2001:db8::1" && !reflect.DeepEqual(f.Usernames, map[string]int{"root": 1, "admin": 1}) {
+			t.Errorf("expected root and admin for %s, got %v", f.IPAddress, f.Usernames)
+		}
+	}
+
+	nets, err := parseIPNets([]string{"2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range failures {
+		if want := strings.HasPrefix(f.IPAddress, "2001:db8:"); containsIP(nets, f.IPAddress) != want {
+			t.Errorf("expected %s in 2001:db8::/32 to be %t", f.IPAddress, want)
+		}
+	}
+}
+
+// sshd logs a failed login more than once, as an invalid user, a PAM
+// authentication failure and a failed password; those count once per
+// attempt. Lines without a pid can't be told apart, so they all count.
+func TestAnalyzeAuthLogOverlappingPatterns(t *testing.T) {
+	file := writeAuthLog(t,
+		"Jan 15 10:23:45 box sshd[100]: Invalid user admin from 203.0.113.5 port 4000",
+		"Jan 15 10:23:45 box sshd[100]: pam_unix(sshd:auth): check pass; user unknown",
+		"Jan 15 10:23:45 box sshd[100]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.5",
+		"Jan 15 10:23:47 box sshd[100]: Failed password for invalid user admin from 203.0.113.5 port 4000 ssh2",
+		"Jan 15 10:23:48 box sshd[100]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.5",
+		"Jan 15 10:23:50 box sshd[100]: Failed password for invalid user admin from 203.0.113.5 port 4000 ssh2",
+		"Jan 15 10:24:01 box sshd[200]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=203.0.113.6  user=root",
+		"Jan 15 10:24:03 box sshd[200]: Failed password for root from 203.0.113.6 port 4001 ssh2",
+		"Jan 15 10:24:05 box sshd[300]: Invalid user test from 203.0.113.7 port 4002",
+		// the pid of a previous connection, from another address
+		"Jan 15 10:25:00 box sshd[100]: Failed password for root from 203.0.113.7 port 4003 ssh2",
+		"Failed password for root from 203.0.113.8 port 22 ssh2",
+		"Failed password for root from 203.0.113.8 port 22 ssh2",
+	)
+
+	failures, err := AnalyzeAuthLog(context.Background(), AuthLogSource{LogFile: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"203.0.113.5": 2, "203.0.113.6": 1, "203.0.113.7": 2, "203.0.113.8": 2}
+	if got := failuresByIP(failures); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	usernames := map[string]map[string]int{
+		"203.0.113.5": {"admin": 2},
+		"203.0.113.6": {"root": 1},
+		"203.0.113.7": {"test": 1, "root": 1},
+	}
+	for _, f := range failures {
+		if want, ok := usernames[f.IPAddress]; ok && !reflect.DeepEqual(f.Usernames, want) {
+			t.Errorf("expected %v for %s, got %v", want, f.IPAddress, f.Usernames)
+		}
+	}
+}
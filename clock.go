@@ -0,0 +1,131 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Offset of the clock over which it's an alert, when none is configured.
+const defaultClockOffsetThreshold = time.Second
+
+// Whether the clock is synchronized with NTP. A wrong clock breaks TLS and
+// makes log timestamps lie.
+type ClockSync struct {
+	Synchronized bool `json:"synchronized"`
+	// How far the clock is ahead of NTP time, negative when it's behind.
+	// Only known with chrony, or systemd-timesyncd.
+	Offset      time.Duration `json:"offset"`
+	OffsetKnown bool          `json:"offset_known"`
+	// The tool the status came from, chronyc or timedatectl
+	Source string `json:"source"`
+}
+
+// Returns a simple string representation of this struct.
+func (c ClockSync) String() string {
+	str := "not synchronized"
+	if c.Synchronized {
+		str = "synchronized"
+	}
+	if c.OffsetKnown {
+		str += fmt.Sprintf(", offset %s", c.Offset)
+	}
+
+	return str
+}
+
+// Gets the NTP synchronization status of the clock from `chronyc tracking',
+// or else from timedatectl. Boxes with neither, or with timedatectl but
+// without systemd, can't tell, so nil is returned rather than an error.
+func GetClockSync(ctx context.Context) (*ClockSync, error) {
+	if _, err := exec.LookPath("chronyc"); err == nil {
+		out, err := clockCommand(ctx, "chronyc", "tracking")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to get the clock status from chronyc: %s", err)
+		}
+		return parseChronyTracking(string(out)), nil
+	}
+
+	// timedatectl asks systemd, which needn't be running, like in containers.
+	if _, err := exec.LookPath("timedatectl"); err != nil {
+		return nil, nil
+	}
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return nil, nil
+	}
+	out, err := clockCommand(ctx, "timedatectl", "show", "--property=NTPSynchronized", "--value")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the clock status from timedatectl: %s", err)
+	}
+	clock := &ClockSync{Synchronized: strings.TrimSpace(string(out)) == "yes", Source: "timedatectl"}
+	// only systemd-timesyncd knows the offset, other NTP daemons don't tell.
+	if out, err = clockCommand(ctx, "timedatectl", "timesync-status"); err == nil {
+		clock.Offset, clock.OffsetKnown = parseTimesyncOffset(string(out))
+	}
+
+	return clock, nil
+}
+
+// Runs the command with the C locale, so its output can be parsed.
+func clockCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.WaitDelay = killWaitDelay
+	return cmd.Output()
+}
+
+// Parses the output of `chronyc tracking', which has lines like
+//
+//	System time     : 0.000012345 seconds slow of NTP time
+//	Leap status     : Normal
+//
+// where a leap status of `Not synchronised' means the clock isn't.
+func parseChronyTracking(out string) *ClockSync {
+	clock := &ClockSync{Source: "chronyc"}
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		val = strings.TrimSpace(val)
+
+		switch strings.TrimSpace(key) {
+		case "Leap status":
+			clock.Synchronized = val != "Not synchronised"
+		case "System time":
+			fld := strings.Fields(val)
+			if len(fld) < 3 {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(fld[0], 64)
+			if err != nil {
+				continue
+			}
+			if fld[2] == "slow" {
+				seconds = -seconds
+			}
+			clock.Offset, clock.OffsetKnown = time.Duration(seconds*float64(time.Second)), true
+		}
+	}
+
+	return clock
+}
+
+// Parses the offset from the output of `timedatectl timesync-status', from a
+// line like `Offset: -1.234ms'.
+func parseTimesyncOffset(out string) (time.Duration, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(key) != "Offset" {
+			continue
+		}
+		offset, err := time.ParseDuration(strings.TrimSpace(val))
+		return offset, err == nil
+	}
+
+	return 0, false
+}
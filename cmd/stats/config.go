@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/krpors/stats"
+	"sort"
+)
+
+// Runs the config subcommand: prints the settings in effect, merged from the
+// defaults, the configuration file and the environment, as an ini file
+// whatever the format of the configuration file. Empty settings show their
+// default, like they're used. Secrets are redacted.
+func printConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error, overrides the LogLevel setting")
+	config := fs.String("config", "", "path of the configuration file, overrides STATS_CONFIG and ~/.config/stats/config")
+	fs.Parse(args)
+
+	cfg, configFile := loadConfig(*config, *logLevel)
+	effective := stats.RedactSettings(stats.EffectiveSettings(cfg.Settings))
+
+	keys := make([]string, 0, len(effective))
+	for key := range effective {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("; effective configuration of %s\n", configFile)
+	for _, key := range keys {
+		fmt.Printf("%s=%s\n", key, effective[key])
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/krpors/stats"
+	"os"
+	"time"
+)
+
+// Time a single check of the doctor subcommand may take.
+const checkTimeout = 30 * time.Second
+
+// Runs the doctor subcommand: runs every check, and prints whether it passed.
+// Exits with 1 when a critical check failed, so it can be scripted.
+func doctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error, overrides the LogLevel setting")
+	config := fs.String("config", "", "path of the configuration file, overrides STATS_CONFIG and ~/.config/stats/config")
+	fs.Parse(args)
+
+	cfg, _ := loadConfig(*config, *logLevel)
+
+	failed := false
+	for _, check := range stats.DoctorChecks(cfg) {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		err := check.Run(ctx)
+		cancel()
+
+		switch {
+		case err == nil:
+			fmt.Printf("PASS  %s\n", check.Name)
+		case check.Critical:
+			fmt.Printf("FAIL  %s: %s\n", check.Name, err)
+			failed = true
+		default:
+			fmt.Printf("WARN  %s: %s\n", check.Name, err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
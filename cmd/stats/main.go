@@ -0,0 +1,326 @@
+// The stats command collects a report of this box, and mails it or sends it
+// to a webhook. See the stats package for the collectors.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/krpors/stats"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Reads the configuration and sets up logging. The config flag wins over the
+// STATS_CONFIG environment variable, the log level flag wins over the
+// LogLevel setting. Returns the configuration and the path of the
+// configuration file. Exits when the configuration can't be used, or has just
+// been created with placeholders.
+func loadConfig(config, logLevel string) (stats.Config, string) {
+	// until the configuration is read, the flag is all there is.
+	if logLevel != "" {
+		if err := stats.SetupLogging(logLevel); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	configFile, err := stats.ConfigFile(config)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	cfg, err := stats.ReadConfiguration(configFile)
+	var created *stats.ConfigCreatedError
+	if errors.As(err, &created) {
+		// nothing useful to do with the placeholders, so that's all for now.
+		slog.Info(err.Error())
+		os.Exit(0)
+	}
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if logLevel == "" {
+		if err = stats.SetupLogging(cfg.LogLevel); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	return cfg, configFile
+}
+
+// Collects a report and prints it as tables, colored when printing to a
+// terminal and NO_COLOR isn't set. The state is read, so the changes since the
+// previous report show, but not saved: looking doesn't count as reporting.
+func printTable(cfg stats.Config, configFile string) {
+	var err error
+	cfg.State, err = stats.LoadState(stats.StateFile(configFile))
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := stats.CollectReport(ctx, cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	info, err := os.Stdout.Stat()
+	color := err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+	if err = stats.WriteTable(os.Stdout, &report, color); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// Entry point.
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "doctor":
+			doctor(os.Args[2:])
+			return
+		case "config":
+			printConfig(os.Args[2:])
+			return
+		}
+	}
+
+	format := flag.String("format", "mail", "output format: `mail' sends the report, `oneline' prints a status line, `text' prints tables")
+	noNewline := flag.Bool("n", false, "do not print a trailing newline with the oneline format")
+	dryRun := flag.Bool("dry-run", false, "print the mail to stdout instead of sending it")
+	output := flag.String("output", "", "write the HTML report to this file, overrides the OutputFile setting")
+	logLevel := flag.String("log-level", "", "log level: debug, info, warn or error, overrides the LogLevel setting")
+	config := flag.String("config", "", "path of the configuration file, overrides STATS_CONFIG and ~/.config/stats/config")
+	interval := flag.Duration("interval", 0, "keep running, and report every interval (like 24h) until stopped, rather than once")
+	flag.Parse()
+
+	cfg, configFile := loadConfig(*config, *logLevel)
+
+	switch *format {
+	case "mail":
+	case "oneline":
+		line, err := stats.FormatOneLine(context.Background(), cfg)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		fmt.Print(line)
+		if !*noNewline {
+			fmt.Println()
+		}
+		return
+	case "text":
+		printTable(cfg, configFile)
+		return
+	default:
+		slog.Error(fmt.Sprintf("Unknown format `%s'", *format))
+		os.Exit(1)
+	}
+
+	r := &reporter{cfg: cfg, configFile: configFile, dryRun: *dryRun}
+	r.outputFile = cfg.OutputFile
+	if *output != "" {
+		r.outputFile = *output
+	}
+	var err error
+	r.webhook, err = stats.WebhookNotifierFromConfig(cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	// when writing to a file or calling a webhook, only mail when a mail host,
+	// Maildir or sendmail is configured too.
+	r.sendMail = cfg.Mail.MailHost != "" || cfg.DeliveryMethod == stats.DELIVERY_MAILDIR ||
+		cfg.DeliveryMethod == stats.DELIVERY_SENDMAIL || (r.outputFile == "" && r.webhook == nil)
+	if r.sendMail && !*dryRun {
+		if err = stats.ValidateConfig(cfg); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	r.mailer = stats.MailNotifierFromConfig(cfg)
+
+	// stop collecting when interrupted, rather than waiting for the timeout.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *interval <= 0 {
+		if err = r.jitter(ctx); err == nil {
+			err = r.report(ctx)
+		}
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// the first report is right away, a failed one doesn't stop the next.
+	slog.Info("Reporting every interval until stopped", "interval", *interval)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if err = r.report(ctx); err != nil && ctx.Err() == nil {
+			slog.Error(err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped reporting")
+			return
+		case <-ticker.C:
+		}
+		if err = r.jitter(ctx); err != nil {
+			slog.Info("Stopped reporting")
+			return
+		}
+	}
+}
+
+// Collects and delivers reports, see report.
+type reporter struct {
+	cfg        stats.Config
+	configFile string
+	dryRun     bool
+	// Where the HTML report is written, if anywhere
+	outputFile string
+	// Whether to mail the report, next to the webhook and the output file
+	sendMail bool
+	mailer   *stats.MailNotifier
+	webhook  *stats.WebhookNotifier
+}
+
+// Waits a random while, up to the StartupJitter, so boxes sharing a schedule
+// don't all report at once. Returns the error of the context when it's done
+// before that.
+func (r *reporter) jitter(ctx context.Context) error {
+	wait := stats.Jitter(r.cfg.StartupJitter)
+	if wait <= 0 || r.dryRun {
+		return nil
+	}
+
+	slog.Info("Waiting before collecting (startup jitter)", "wait", wait)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// Collects a report and delivers it, or prints it on a dry run. The state and
+// the history are read before, and saved after, so every report tells what
+// changed since the previous one.
+func (r *reporter) report(ctx context.Context) error {
+	cfg := r.cfg
+
+	stateFile := stats.StateFile(r.configFile)
+	var err error
+	cfg.State, err = stats.LoadState(stateFile)
+	if err != nil {
+		return err
+	}
+	// the trends are a nicety, no reason to skip the report.
+	historyFile := stats.HistoryFile(r.configFile)
+	cfg.History, err = stats.LoadHistory(historyFile)
+	if err != nil {
+		slog.Warn("Reporting without trends", "error", err)
+	}
+
+	report, err := stats.CollectReport(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	// every run is history, whether it's reported or not.
+	if !r.dryRun {
+		if err = stats.AppendHistoryFromConfig(historyFile, &report, cfg); err != nil {
+			slog.Warn("Unable to update the history", "error", err)
+		}
+	}
+	if cfg.AlertOnly && !report.HasAlertOf(cfg.AlertMinSeverity) {
+		slog.Info("Nothing to report")
+		// the run still counts as the previous one, or the next would see a
+		// gap, and compare with stale counters.
+		if r.dryRun {
+			return nil
+		}
+		cfg.State.Update(&report)
+		return cfg.State.Save(stateFile)
+	}
+
+	notifiers := make([]stats.Notifier, 0)
+	if r.sendMail {
+		notifiers = append(notifiers, r.mailer)
+	}
+	if r.webhook != nil {
+		notifiers = append(notifiers, r.webhook)
+	}
+
+	if r.dryRun {
+		if r.sendMail || r.outputFile != "" {
+			prepared, err := r.mailer.Prepare(&report)
+			if err != nil {
+				return err
+			}
+			os.Stdout.Write(stats.BuildMessage(prepared))
+		}
+		if r.webhook != nil {
+			payload, err := r.webhook.Payload(&report)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\nPOST %s\n%s\n", r.webhook.URL, payload)
+		}
+		return nil
+	}
+
+	if r.outputFile != "" {
+		prepared, err := r.mailer.Prepare(&report)
+		if err != nil {
+			return err
+		}
+		if err = stats.WriteReport(r.outputFile, prepared.Body); err != nil {
+			return err
+		}
+	}
+
+	// try every notifier, even when an earlier one failed.
+	failed := false
+	for _, notifier := range notifiers {
+		if err = notifier.Send(report); err != nil {
+			slog.Error(err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		return errors.New("Not every notifier delivered the report")
+	}
+
+	// remember what we've reported, so the next run can tell what changed.
+	cfg.State.Update(&report)
+	if err = cfg.State.Save(stateFile); err != nil {
+		return err
+	}
+
+	// cron only mails output, so print something to show the run happened.
+	if len(notifiers) > 0 {
+		fmt.Printf("Report sent: %s\n", report.Summary())
+	} else {
+		fmt.Printf("Report written to %s: %s\n", r.outputFile, report.Summary())
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/krpors/stats"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Runs the serve subcommand: serves the report over HTTP, until interrupted or
+// terminated. Requests which are being served then may finish within the
+// CollectTimeout, after which they're canceled along with their collectors.
+//
+// There is no authentication, and the report tells who logs in, who failed
+// to and what listens where. So only localhost is listened on by default,
+// serving other hosts takes an explicit -addr like :8080, preferably behind
+// a reverse proxy which does authenticate.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on; the report is unauthenticated, so only use another interface, like :8080, behind a proxy which authenticates")
+	cacheTTL := fs.Duration("cache", stats.DefaultServeCacheTTL, "how long a collected report is served before collecting a new one")
+	metrics := fs.Bool("metrics", false, "serve the report as Prometheus metrics on /metrics too")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn or error, overrides the LogLevel setting")
+	config := fs.String("config", "", "path of the configuration file, overrides STATS_CONFIG and ~/.config/stats/config")
+	fs.Parse(args)
+
+	cfg, configFile := loadConfig(*config, *logLevel)
+
+	// the state is never saved, it's up to the mails to remember what has
+	// been reported. Only the external IP is updated in memory.
+	var err error
+	cfg.State, err = stats.LoadState(stats.StateFile(configFile))
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	cfg.History, err = stats.LoadHistory(stats.HistoryFile(configFile))
+	if err != nil {
+		slog.Warn("Serving without trends", "error", err)
+	}
+
+	rs := &stats.ReportServer{
+		Config:   cfg,
+		CacheTTL: *cacheTTL,
+		Metrics:  *metrics,
+	}
+	// the requests, and so the collectors, are only canceled when they don't
+	// finish in time while shutting down.
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           rs.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Serving the report", "addr", *addr)
+	served := make(chan error, 1)
+	go func() { served <- server.ListenAndServe() }()
+	select {
+	case err = <-served:
+		slog.Error(err.Error())
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// another signal kills right away.
+	stop()
+
+	slog.Info("Shutting down", "timeout", cfg.CollectTimeout)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.CollectTimeout)
+	defer shutdownCancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Canceling the requests which are still running", "error", err)
+		cancel()
+		server.Close()
+	}
+	if err = <-served; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error(err.Error())
+	}
+	slog.Info("Stopped serving")
+}
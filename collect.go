@@ -0,0 +1,244 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Time the collectors together may take, when none is configured.
+const defaultCollectTimeout = time.Minute
+
+// Collects a part of the report, like the disk usage or the failed logins.
+// The collectors of a report run concurrently.
+type Collector interface {
+	// The name of the section, like df. The error of the collector is in
+	// ReportData.Errors by this name, and DisabledSections turns the
+	// collector off by it.
+	Name() string
+	// Collects the data of the section. A collector which fails may still
+	// return what it could collect next to the error.
+	Collect(ctx context.Context) (interface{}, error)
+}
+
+// A collector which is just a function, see NewCollector.
+type funcCollector struct {
+	name    string
+	collect func(ctx context.Context) (interface{}, error)
+}
+
+// Returns the name of the collector.
+func (f funcCollector) Name() string {
+	return f.name
+}
+
+// Collects by calling the function.
+func (f funcCollector) Collect(ctx context.Context) (interface{}, error) {
+	return f.collect(ctx)
+}
+
+// Creates a collector from a name and a function, for collectors which need
+// no type of their own.
+func NewCollector(name string, collect func(ctx context.Context) (interface{}, error)) Collector {
+	return funcCollector{name, collect}
+}
+
+// The collectors registered next to the built-in ones, see RegisterCollector.
+var (
+	registryMu sync.Mutex
+	registry   []Collector
+)
+
+// Registers a collector which runs for every report, next to the built-in
+// ones. Its result is in ReportData.Extra by its name, so a custom template
+// can render it, and it's in the JSON of the report. Registering a name twice,
+// or the name of a built-in section, panics, like registering an HTTP handler
+// twice does.
+func RegisterCollector(collector Collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := collector.Name()
+	if isBuiltinSection(name) || registeredSection(name) {
+		panic(fmt.Sprintf("stats: there is a collector named %q already", name))
+	}
+	registry = append(registry, collector)
+}
+
+// Returns a copy of the registered collectors, in the order of registration.
+func registeredCollectors() []Collector {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	return append([]Collector(nil), registry...)
+}
+
+// Returns whether a collector is registered with the name. The registry must
+// be locked.
+func registeredSection(name string) bool {
+	for _, collector := range registry {
+		if collector.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The built-in sections of the report, by the name of their collector. Every
+// one of them can be turned off with the DisabledSections setting.
+var reportSections = []string{
+	"system", "uptime", "ip", "interfaces", "authlog", "df", "diskio", "fail2ban", "load", "memory",
+	"processes", "temperature", "smart", "clock", "systemd", "updates", "logins", "sockets", "commands",
+	"logtails",
+}
+
+// Runs the collectors of a report concurrently, until they are all done or
+// the context expires.
+type collection struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+	// collectors which aren't run at all, by name
+	disabled map[string]bool
+
+	// guards everything below
+	mu      sync.Mutex
+	closed  bool
+	pending map[string]bool
+	results map[string]interface{}
+	errs    map[string]string
+}
+
+// Creates a collection which stops waiting for its collectors when the
+// context expires. The disabled collectors are skipped, names which aren't a
+// section are logged, since they're probably a typo.
+func newCollection(ctx context.Context, disabled []string) *collection {
+	c := &collection{
+		ctx:      ctx,
+		disabled: make(map[string]bool),
+		pending:  make(map[string]bool),
+		results:  make(map[string]interface{}),
+		errs:     make(map[string]string),
+	}
+	for _, name := range disabled {
+		registryMu.Lock()
+		known := isBuiltinSection(name) || registeredSection(name)
+		registryMu.Unlock()
+		if !known {
+			slog.Warn("Unknown section in "+SETTING_SECTIONS_OFF, "section", name)
+		}
+		c.disabled[name] = true
+	}
+
+	return c
+}
+
+// Returned by the collectors of the unsupportedSections, which have nothing to
+// collect from on this platform.
+var errUnsupportedPlatform = fmt.Errorf("Unsupported on this platform (%s)", runtime.GOOS)
+
+// Returns whether the section has no implementation on this platform.
+func isUnsupportedSection(name string) bool {
+	for _, section := range unsupportedSections {
+		if section == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns whether name is one of the reportSections.
+func isBuiltinSection(name string) bool {
+	for _, section := range reportSections {
+		if section == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Starts a collector in the background. Its result is only kept when the
+// collection is still waiting, so a collector finishing after the deadline
+// can't change the report while it's being assembled. Disabled collectors
+// aren't started, so their section is left empty without doing any of the
+// work.
+func (c *collection) Go(collector Collector) {
+	name := collector.Name()
+	if c.disabled[name] {
+		slog.Debug("Collector disabled", "collector", name)
+		return
+	}
+
+	c.mu.Lock()
+	c.pending[name] = true
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		var result interface{}
+		err := runCollector(name, func() (err error) {
+			result, err = collector.Collect(c.ctx)
+			return
+		})
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			return
+		}
+		delete(c.pending, name)
+		if result != nil {
+			c.results[name] = result
+		}
+		if err != nil {
+			c.errs[name] = err.Error()
+		}
+	}()
+}
+
+// Waits until all collectors are done, or the context expires. Collectors
+// which are still running by then are recorded as failed. Returns the results
+// of the collectors, and why collectors failed, by collector name.
+func (c *collection) Wait() (map[string]interface{}, map[string]string) {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-c.ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for name := range c.pending {
+		slog.Warn("Collector did not finish in time", "collector", name)
+		c.errs[name] = fmt.Sprintf("Did not finish in time (%s)", c.ctx.Err())
+	}
+
+	return c.results, c.errs
+}
+
+// Runs a single collector of the report, and logs how long it took. Failures
+// are logged as a warning, since the report can do without.
+func runCollector(name string, collector func() error) error {
+	start := time.Now()
+	err := collector()
+	if err != nil {
+		slog.Warn("Collector failed", "collector", name, "duration", time.Since(start), "error", err)
+		return err
+	}
+
+	slog.Debug("Collector done", "collector", name, "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,122 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Registers the collectors for the duration of the test, and restores the
+// registry afterwards.
+func registerForTest(t *testing.T, collectors ...Collector) {
+	registryMu.Lock()
+	saved := append([]Collector(nil), registry...)
+	registryMu.Unlock()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = saved
+		registryMu.Unlock()
+	})
+
+	for _, collector := range collectors {
+		RegisterCollector(collector)
+	}
+}
+
+// Returns a configuration with every built-in section turned off, so only the
+// registered collectors run.
+func registeredOnlyConfig(t *testing.T, timeout time.Duration) Config {
+	cfg, err := NewConfig(map[string]string{
+		SETTING_SECTIONS_OFF: strings.Join(reportSections, ","),
+		SETTING_COLL_TIMEOUT: timeout.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+// A registered collector runs next to the built-in ones: its result is in
+// Extra, its error in Errors, and one which doesn't finish within the
+// CollectTimeout is recorded as failed without holding up the report.
+func TestRegisteredCollector(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	registerForTest(t,
+		NewCollector("fake", func(ctx context.Context) (interface{}, error) {
+			return "collected", nil
+		}),
+		NewCollector("failing", func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("no such thing")
+		}),
+		// ignores the context on purpose, like a collector stuck in a
+		// system call would.
+		NewCollector("slow", func(ctx context.Context) (interface{}, error) {
+			<-release
+			return "too late", nil
+		}),
+	)
+
+	const timeout = 200 * time.Millisecond
+	start := time.Now()
+	report, err := CollectReport(context.Background(), registeredOnlyConfig(t, timeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > timeout+time.Second {
+		t.Errorf("expected the report after the timeout of %s, took %s", timeout, took)
+	}
+
+	if got := report.Extra["fake"]; got != "collected" {
+		t.Errorf("expected the result of the fake collector in Extra, got %v", got)
+	}
+	if _, ok := report.Errors["fake"]; ok {
+		t.Errorf("expected no error for the fake collector, got %s", report.Errors["fake"])
+	}
+	if got := report.Errors["failing"]; got != "no such thing" {
+		t.Errorf("expected the error of the failing collector in Errors, got %q", got)
+	}
+	if _, ok := report.Extra["failing"]; ok {
+		t.Error("expected no result for the failing collector")
+	}
+	if got := report.Errors["slow"]; !strings.Contains(got, "Did not finish in time") {
+		t.Errorf("expected the slow collector to time out, got %q", got)
+	}
+	if _, ok := report.Extra["slow"]; ok {
+		t.Error("expected no result for the slow collector")
+	}
+}
+
+// A registered collector can be turned off like a built-in section, and its
+// name can't be taken twice.
+func TestRegisteredCollectorDisabled(t *testing.T) {
+	ran := false
+	registerForTest(t, NewCollector("fake", func(ctx context.Context) (interface{}, error) {
+		ran = true
+		return "collected", nil
+	}))
+
+	cfg := registeredOnlyConfig(t, time.Second)
+	cfg.DisabledSections = append(cfg.DisabledSections, "fake")
+	report, err := CollectReport(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran || report.Extra["fake"] != nil {
+		t.Error("expected the disabled collector not to run")
+	}
+
+	for _, name := range []string{"fake", "df"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %q to panic", name)
+				}
+			}()
+			RegisterCollector(NewCollector(name, nil))
+		}()
+	}
+}
@@ -0,0 +1,110 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of the settings defining custom commands. Every setting like
+// `Command.Failed units = systemctl --failed' adds a command, labeled by the
+// part after the prefix, to the report.
+const SETTING_COMMAND_PREFIX = "Command."
+
+// Defaults for the custom commands.
+const (
+	defaultCommandTimeout   = 10 * time.Second
+	defaultCommandMaxOutput = 4096
+)
+
+// Time a killed command may take to let go of its output. Children which keep
+// the output open, or a command hanging in the kernel on a dead mount, would
+// block the report forever otherwise.
+const killWaitDelay = time.Second
+
+// A custom command and what it printed.
+type CustomCommand struct {
+	Label   string `json:"label"`
+	Command string `json:"command"`
+	// The standard output, cut off at the maximum output length
+	Output    string `json:"output"`
+	Truncated bool   `json:"truncated"`
+	// Why the command failed, when it did
+	Error string `json:"error"`
+}
+
+// Returns the custom commands defined in the settings, sorted by their label.
+func customCommands(settings map[string]string) []CustomCommand {
+	commands := make([]CustomCommand, 0)
+	for key, command := range settings {
+		if label := strings.TrimPrefix(key, SETTING_COMMAND_PREFIX); label != key && strings.TrimSpace(command) != "" {
+			commands = append(commands, CustomCommand{Label: strings.TrimSpace(label), Command: command})
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Label < commands[j].Label })
+
+	return commands
+}
+
+// Runs the commands concurrently with sh -c, each bounded by the timeout, and
+// stores their output. Only the first maxOutput bytes of the output are kept,
+// so a runaway command can't flood the report. A command which fails keeps
+// the output it printed before failing.
+func RunCustomCommands(ctx context.Context, commands []CustomCommand, timeout time.Duration, maxOutput int) {
+	wg := sync.WaitGroup{}
+	for i := range commands {
+		wg.Add(1)
+		go func(cmd *CustomCommand) {
+			defer wg.Done()
+			cmd.run(ctx, timeout, maxOutput)
+		}(&commands[i])
+	}
+	wg.Wait()
+}
+
+// Runs a single command, see RunCustomCommands.
+func (c *CustomCommand) run(ctx context.Context, timeout time.Duration, maxOutput int) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out := &limitedBuffer{max: maxOutput}
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Stdout = out
+	cmd.WaitDelay = killWaitDelay
+	err := cmd.Run()
+
+	c.Output = out.buf.String()
+	c.Truncated = out.truncated
+	if ctx.Err() == context.DeadlineExceeded {
+		c.Error = fmt.Sprintf("Did not finish within %s", timeout)
+	} else if err != nil {
+		c.Error = err.Error()
+	}
+}
+
+// A buffer which silently drops everything after the first max bytes. The
+// bytes.Buffer is not embedded, as its ReadFrom would bypass Write.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+// Writes what still fits, and pretends to have written all of p so the
+// command doesn't fail on a short write.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+
+	return b.buf.Write(p)
+}
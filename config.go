@@ -0,0 +1,444 @@
+package stats
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned by ReadConfiguration when it created a default configuration file.
+type ConfigCreatedError struct {
+	ConfigFile string
+}
+
+// Tells the user what to do with the new configuration file.
+func (e *ConfigCreatedError) Error() string {
+	return fmt.Sprintf("Edit your configuration at `%s' then rerun", e.ConfigFile)
+}
+
+// What a report is collected with: the settings, the state of the previous
+// run to find out what changed since then, and the history of the previous
+// runs for the trends. A nil state is the same as an empty one, like before
+// the first run.
+//
+// The settings are decoded into the typed fields by NewConfig, which is what
+// ReadConfiguration returns. A Config with just the Settings is decoded by
+// CollectReport.
+type Config struct {
+	// The settings as read from the configuration file and the environment
+	Settings map[string]string
+	State    *State
+	History  []HistoryRecord
+
+	// How the report is delivered
+	OutputFile       string        `setting:"OutputFile"`
+	DeliveryMethod   string        `setting:"DeliveryMethod"`
+	MaildirPath      string        `setting:"MaildirPath"`
+	SendmailPath     string        `setting:"SendmailPath"`
+	AttachReport     string        `setting:"AttachReport"`
+	TemplatePath     string        `setting:"TemplatePath"`
+	AlertOnly        bool          `setting:"SendOnlyOnAlert"`
+	AlertMinSeverity Severity      `setting:"AlertMinSeverity"`
+	StartupJitter    time.Duration `setting:"StartupJitter"`
+	OneLineFields    []string      `setting:"OneLineFields"`
+	WebhookURL       string        `setting:"WebhookURL"`
+	WebhookFormat    string        `setting:"WebhookFormat"`
+	WebhookTimeout   time.Duration `setting:"WebhookTimeout"`
+	LogLevel         string        `setting:"LogLevel"`
+	Mail             MailSettings
+
+	// What the report is collected from
+	CollectTimeout   time.Duration `setting:"CollectTimeout"`
+	Window           time.Duration `setting:"ReportWindow"`
+	Locale           string        `setting:"Locale"`
+	ExtIpProviders   []string      `setting:"ExtIpProviders"`
+	ExtIpTimeout     time.Duration `setting:"ExtIpTimeout"`
+	ExtIpCacheTTL    time.Duration `setting:"ExtIpCacheTTL"`
+	DfCommand        string        `setting:"DfCommand"`
+	DfFlags          string        `setting:"DfFlags"`
+	DfTimeout        time.Duration `setting:"DfTimeout"`
+	DiskInclude      []string      `setting:"DiskIncludeMounts"`
+	DiskExclude      []string      `setting:"DiskExcludeMounts"`
+	DiskExcludeFs    []string      `setting:"DiskExcludeFstypes"`
+	DiskAliases      []string      `setting:"DiskMountAliases"`
+	AuthLog          AuthLogSource
+	InterfaceFilter  []string      `setting:"InterfaceFilter"`
+	GeoIPDatabase    string        `setting:"GeoIPDatabase"`
+	ResolveHostnames bool          `setting:"ResolveHostnames"`
+	ResolveTimeout   time.Duration `setting:"ResolveTimeout"`
+	Fail2banLog      string        `setting:"Fail2banLog"`
+	TopProcessCount  int           `setting:"TopProcessCount"`
+	WatchedProcesses []string      `setting:"WatchedProcesses"`
+	PackageManager   string        `setting:"PackageManager"`
+	RecentLoginCount int           `setting:"RecentLoginCount"`
+	CommandTimeout   time.Duration `setting:"CommandTimeout"`
+	CommandMaxOutput int           `setting:"CommandMaxOutput"`
+	KnownHosts       []string      `setting:"KnownHosts"`
+	AllowedPorts     []string      `setting:"AllowedPorts"`
+	LogTails         []string      `setting:"LogTails"`
+	DiskIOAll        bool          `setting:"DiskIOAllDevices"`
+	DisabledSections []string      `setting:"DisabledSections"`
+	// The custom commands, from the settings starting with Command.
+	Commands []CustomCommand
+
+	// When something in the report is an alert
+	DiskThreshold     int           `setting:"DiskUsageThreshold"`
+	InodeThreshold    int           `setting:"InodeThreshold"`
+	TempThreshold     int           `setting:"TempThreshold"`
+	SwapThreshold     int           `setting:"SwapThreshold"`
+	RebootThreshold   time.Duration `setting:"RebootThreshold"`
+	GapThreshold      time.Duration `setting:"ReportGapThreshold"`
+	ClockOffset       time.Duration `setting:"ClockOffsetThreshold"`
+	FailedIpRetention time.Duration `setting:"FailedIpRetention"`
+	RateWindow        time.Duration `setting:"FailedLoginRateWindow"`
+	RateThreshold     int           `setting:"FailedLoginRateThreshold"`
+	RespawnWindow     time.Duration `setting:"RespawnWindow"`
+	RespawnThreshold  int           `setting:"RespawnThreshold"`
+	AlertLimits       AlertLimits
+
+	// How much history is kept for the trends. MaxHistoryAge, when set, is
+	// the age of the records kept instead of HistoryDays
+	HistoryDays       int           `setting:"HistoryDays"`
+	MaxHistoryEntries int           `setting:"MaxHistoryEntries"`
+	MaxHistoryAge     time.Duration `setting:"MaxHistoryAge"`
+
+	decoded bool
+}
+
+// Creates the configuration from the settings, decoding every setting into
+// its typed field. Settings which are absent or empty get their defaults.
+// Returns an error for the first setting which can't be decoded, like a
+// threshold which isn't a number.
+func NewConfig(settings map[string]string) (Config, error) {
+	cfg := Config{Settings: settings}
+	if err := cfg.decode(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// Decodes the settings into the typed fields, see NewConfig.
+func (cfg *Config) decode() error {
+	values := EffectiveSettings(cfg.Settings)
+	if err := decodeSettings(reflect.ValueOf(cfg).Elem(), values); err != nil {
+		return err
+	}
+	// without a window of its own, the auth log is scoped like the rest of
+	// the report.
+	if cfg.AuthLog.Window == 0 {
+		cfg.AuthLog.Window = cfg.Window
+	}
+	cfg.AuthLog.Patterns = authPatterns(values)
+	cfg.Commands = customCommands(values)
+	cfg.decoded = true
+
+	return nil
+}
+
+// Decodes the settings into the fields of the struct which have a setting
+// tag, and into the untagged fields which are structs themselves.
+func decodeSettings(v reflect.Value, values map[string]string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, f := v.Field(i), v.Type().Field(i)
+		key := f.Tag.Get("setting")
+		if key == "" {
+			if f.IsExported() && f.Type.Kind() == reflect.Struct {
+				if err := decodeSettings(field, values); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		switch field.Interface().(type) {
+		case string:
+			field.SetString(strings.TrimSpace(values[key]))
+		case bool:
+			b, err := SettingBool(values, key, false)
+			if err != nil {
+				return err
+			}
+			field.SetBool(b)
+		case int:
+			n, err := SettingInt(values, key, 0)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(n))
+		case time.Duration:
+			d, err := SettingDuration(values, key, 0)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(d))
+		case Severity:
+			s, err := ParseSeverity(strings.TrimSpace(values[key]))
+			if err != nil {
+				return fmt.Errorf("Invalid severity `%s' for setting %s", values[key], key)
+			}
+			field.SetInt(int64(s))
+		case []string:
+			field.Set(reflect.ValueOf(SettingList(values, key, nil)))
+		default:
+			panic(fmt.Sprintf("setting %s has unsupported type %s", key, f.Type))
+		}
+	}
+
+	return nil
+}
+
+// Encodes the fields of the struct which have a setting tag, and the untagged
+// fields which are structs themselves, into values by the name of their
+// setting, the reverse of decodeSettings. Lists stay lists and numbers stay
+// numbers, for the formats which have them. Durations and severities are
+// written the way they're read, like `30s' and `warning'.
+func encodeSettings(v reflect.Value, values map[string]interface{}) {
+	for i := 0; i < v.NumField(); i++ {
+		field, f := v.Field(i), v.Type().Field(i)
+		key := f.Tag.Get("setting")
+		if key == "" {
+			if f.IsExported() && f.Type.Kind() == reflect.Struct {
+				encodeSettings(field, values)
+			}
+			continue
+		}
+
+		switch val := field.Interface().(type) {
+		case time.Duration:
+			values[key] = val.String()
+		case Severity:
+			values[key] = val.String()
+		case []string:
+			values[key] = append([]string{}, val...)
+		default:
+			values[key] = val
+		}
+	}
+}
+
+// The default settings which are placeholders to be edited, rather than what's
+// used when they are absent from the configuration file.
+var placeholderSettings = []string{
+	SETTING_USERNAME,
+	SETTING_PASSWORD,
+	SETTING_MAIL_FROM,
+	SETTING_MAIL_TO,
+	SETTING_MAIL_HOST,
+	SETTING_FROM_ADDR,
+	SETTING_TO_ADDR,
+}
+
+// Returns the settings which are in effect: the given settings, read from the
+// configuration file and the environment, completed with the defaults for
+// the settings which are absent or empty, the way the Config is decoded.
+// Placeholders are not defaults, so those remain absent.
+func EffectiveSettings(settings map[string]string) map[string]string {
+	effective := DefaultSettings()
+	for _, setting := range placeholderSettings {
+		delete(effective, setting)
+	}
+	for key, val := range settings {
+		if strings.TrimSpace(val) != "" {
+			effective[key] = val
+		}
+	}
+
+	return effective
+}
+
+// Returns the default settings, which are written to a newly created
+// configuration file. The mail settings are placeholders which need editing.
+func DefaultSettings() map[string]string {
+	settings := make(map[string]string)
+	settings[SETTING_USERNAME] = "username"
+	settings[SETTING_PASSWORD] = "password"
+	settings[SETTING_MAIL_FROM] = "Server report <blah@example.com>"
+	settings[SETTING_MAIL_TO] = "Name <email@example.com>"
+	settings[SETTING_MAIL_HOST] = "smtp.gmail.com:587"
+	settings[SETTING_MAIL_SUBJECT] = "Server report - {{ .Host }}"
+	settings[SETTING_FROM_ADDR] = "email@example.com"
+	settings[SETTING_TO_ADDR] = "email@example.com"
+	// fail2ban is optional, its log is only analyzed when configured.
+	settings[SETTING_FAIL2BAN_LOG] = ""
+	settings[SETTING_JITTER] = "0s"
+	settings[SETTING_ONELINE] = strings.Join(DefaultOneLineFields, ",")
+	settings[SETTING_EXTIP_PROVS] = strings.Join(defaultExtIPProviders, ",")
+	settings[SETTING_IP_TIMEOUT] = defaultExtIPTimeout.String()
+	settings[SETTING_IP_CACHE_TTL] = defaultExtIPCacheTTL.String()
+	settings[SETTING_DF_COMMAND] = defaultDfCommand
+	settings[SETTING_DF_FLAGS] = strings.Join(defaultDfFlags, " ")
+	settings[SETTING_DF_TIMEOUT] = defaultDfTimeout.String()
+	settings[SETTING_DISK_THRESH] = strconv.Itoa(defaultDiskThreshold)
+	settings[SETTING_INODE_THRESH] = strconv.Itoa(defaultInodeThreshold)
+	settings[SETTING_ALERT_ONLY] = "false"
+	settings[SETTING_MAIL_SEC] = MAIL_SECURITY_STARTTLS
+	settings[SETTING_DELIVERY] = DELIVERY_SMTP
+	settings[SETTING_SENDMAIL] = defaultSendmailPath
+	settings[SETTING_HOOK_TIMEOUT] = defaultWebhookTimeout.String()
+	settings[SETTING_SKIP_VERIFY] = "false"
+	settings[SETTING_MAIL_AUTH] = MAIL_AUTH_PLAIN
+	settings[SETTING_CMD_TIMEOUT] = defaultCommandTimeout.String()
+	settings[SETTING_CMD_MAX_OUT] = strconv.Itoa(defaultCommandMaxOutput)
+	settings[SETTING_PKG_MANAGER] = PACKAGE_MANAGER_AUTO
+	settings[SETTING_LOGIN_COUNT] = strconv.Itoa(defaultRecentLoginCount)
+	settings[SETTING_MAIL_RETRIES] = strconv.Itoa(defaultMailRetries)
+	settings[SETTING_MAIL_DELAY] = defaultMailRetryDelay.String()
+	settings[SETTING_MAIL_DIAL] = defaultMailDialTimeout.String()
+	settings[SETTING_AUTH_LOG] = defaultAuthLog
+	settings[SETTING_AUTH_UNITS] = strings.Join(defaultAuthJournalUnits, ",")
+	settings[SETTING_AUTH_SINCE] = defaultAuthJournalSince
+	settings[SETTING_AUTH_ROTATED] = "false"
+	settings[SETTING_DISKIO_ALL] = "false"
+	settings[SETTING_AUTH_WINDOW] = "0s"
+	settings[SETTING_RATE_WINDOW] = defaultFailedLoginRateWindow.String()
+	settings[SETTING_RATE_THRESH] = strconv.Itoa(defaultFailedLoginRateThreshold)
+	settings[SETTING_WINDOW] = defaultReportWindow.String()
+	settings[SETTING_ATTACH] = ATTACH_NONE
+	settings[SETTING_DISK_CRIT] = strconv.Itoa(defaultDiskCritical)
+	settings[SETTING_FAIL_WARN] = strconv.Itoa(defaultFailedLoginWarning)
+	settings[SETTING_FAIL_CRIT] = strconv.Itoa(defaultFailedLoginCritical)
+	settings[SETTING_ALERT_MIN] = SEVERITY_INFO.String()
+	settings[SETTING_HISTORY_DAYS] = strconv.Itoa(defaultHistoryDays)
+	settings[SETTING_HISTORY_MAX] = "0"
+	settings[SETTING_HISTORY_AGE] = "0"
+	settings[SETTING_GAP_THRESH] = defaultReportGapThreshold.String()
+	settings[SETTING_CLOCK_OFFSET] = defaultClockOffsetThreshold.String()
+	settings[SETTING_IF_FILTER] = "all"
+	settings[SETTING_TOP_PROCS] = strconv.Itoa(defaultTopProcessCount)
+	settings[SETTING_RESPAWN_WIN] = defaultRespawnWindow.String()
+	settings[SETTING_RESPAWN_MAX] = strconv.Itoa(defaultRespawnThreshold)
+	settings[SETTING_TEMP_THRESH] = "0"
+	settings[SETTING_SWAP_THRESH] = strconv.Itoa(defaultSwapThreshold)
+	settings[SETTING_LOG_LEVEL] = DefaultLogLevel
+	settings[SETTING_COLL_TIMEOUT] = defaultCollectTimeout.String()
+	settings[SETTING_REBOOT_LIMIT] = defaultRebootThreshold.String()
+	settings[SETTING_IP_RETENTION] = defaultFailedIpRetention.String()
+	settings[SETTING_PTR_TIMEOUT] = defaultResolveTimeout.String()
+
+	return settings
+}
+
+// Validates the mail related settings, which have no sensible defaults.
+// Required settings must be present, placeholders from the default settings
+// must have been replaced, the mail host must be in the host:port format, and the
+// addresses must be valid email addresses. All problems are reported at once
+// in the returned error, rather than just the first. Settings which can't be
+// decoded at all, like an unknown severity, are reported by NewConfig already.
+func ValidateConfig(cfg Config) error {
+	problems := make([]string, 0)
+	defaults := DefaultSettings()
+	ms := cfg.Mail
+
+	// a setting by its name, which is what the problems refer to.
+	type setting struct{ key, val string }
+	mailFrom, mailTo := setting{SETTING_MAIL_FROM, ms.MailFrom}, setting{SETTING_MAIL_TO, ms.MailTo}
+	fromAddr, toAddr := setting{SETTING_FROM_ADDR, ms.FromAddress}, setting{SETTING_TO_ADDR, ms.ToAddress}
+
+	required := []setting{{SETTING_MAIL_HOST, ms.MailHost}, mailFrom, mailTo, fromAddr, toAddr}
+	switch cfg.DeliveryMethod {
+	case "", DELIVERY_SMTP:
+	case DELIVERY_MAILDIR:
+		// a Maildir needs no mail host, just a place to drop the mail.
+		required = append([]setting{{SETTING_MAILDIR, cfg.MaildirPath}}, required[1:]...)
+	case DELIVERY_SENDMAIL:
+		// the local MTA knows where to send the mail to.
+		required = required[1:]
+	default:
+		problems = append(problems, fmt.Sprintf("%s `%s' must be one of %s, %s or %s", SETTING_DELIVERY,
+			cfg.DeliveryMethod, DELIVERY_SMTP, DELIVERY_MAILDIR, DELIVERY_SENDMAIL))
+	}
+
+	for _, s := range required {
+		if s.val == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", s.key))
+		}
+	}
+
+	// these defaults are merely placeholders. The credentials are optional,
+	// but when given they must not be the placeholders either.
+	for _, s := range []setting{{SETTING_USERNAME, ms.Username}, {SETTING_PASSWORD, ms.Password}, mailFrom, mailTo, fromAddr, toAddr} {
+		if s.val != "" && s.val == defaults[s.key] {
+			if IsSecretSetting(s.key) {
+				problems = append(problems, fmt.Sprintf("%s is still set to its placeholder", s.key))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s is still set to its placeholder `%s'", s.key, s.val))
+			}
+		}
+	}
+
+	if host := ms.MailHost; host != "" {
+		if _, port, err := net.SplitHostPort(host); err != nil {
+			problems = append(problems, fmt.Sprintf("%s `%s' is not in the host:port format", SETTING_MAIL_HOST, host))
+		} else if _, err = strconv.Atoi(port); err != nil {
+			problems = append(problems, fmt.Sprintf("%s `%s' has an invalid port", SETTING_MAIL_HOST, host))
+		}
+	}
+
+	for _, s := range []setting{mailFrom, mailTo, fromAddr, toAddr} {
+		if s.val != "" {
+			if _, err := mail.ParseAddress(s.val); err != nil {
+				problems = append(problems, fmt.Sprintf("%s `%s' is not a valid email address: %s", s.key, s.val, err))
+			}
+		}
+	}
+
+	for _, s := range []setting{{SETTING_MAIL_CC, ms.MailCc}, {SETTING_MAIL_BCC, ms.MailBcc}} {
+		if s.val != "" {
+			if _, err := mail.ParseAddressList(s.val); err != nil {
+				problems = append(problems, fmt.Sprintf("%s `%s' is not a valid list of email addresses: %s", s.key, s.val, err))
+			}
+		}
+	}
+
+	switch ms.Security {
+	case "", MAIL_SECURITY_STARTTLS, MAIL_SECURITY_TLS, MAIL_SECURITY_NONE:
+	default:
+		problems = append(problems, fmt.Sprintf("%s `%s' must be one of %s, %s or %s", SETTING_MAIL_SEC,
+			ms.Security, MAIL_SECURITY_STARTTLS, MAIL_SECURITY_TLS, MAIL_SECURITY_NONE))
+	}
+
+	switch strings.ToLower(ms.AuthMethod) {
+	case "", MAIL_AUTH_PLAIN:
+	case MAIL_AUTH_XOAUTH2:
+		if ms.Username == "" {
+			problems = append(problems, fmt.Sprintf("%s is required for %s", SETTING_USERNAME, MAIL_AUTH_XOAUTH2))
+		}
+		if ms.OAuth.RefreshToken != "" {
+			for _, s := range []setting{{SETTING_OAUTH_CLIENT, ms.OAuth.ClientID}, {SETTING_OAUTH_SECRET, ms.OAuth.ClientSecret}} {
+				if s.val == "" {
+					problems = append(problems, fmt.Sprintf("%s is required with %s", s.key, SETTING_OAUTH_RTOKEN))
+				}
+			}
+		} else if ms.OAuth.AccessToken == "" {
+			problems = append(problems, fmt.Sprintf("%s or %s is required for %s", SETTING_OAUTH_TOKEN, SETTING_OAUTH_RTOKEN, MAIL_AUTH_XOAUTH2))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s `%s' must be one of %s or %s", SETTING_MAIL_AUTH,
+			ms.AuthMethod, MAIL_AUTH_PLAIN, MAIL_AUTH_XOAUTH2))
+	}
+
+	switch strings.ToLower(cfg.AttachReport) {
+	case "", ATTACH_NONE, ATTACH_HTML, ATTACH_JSON:
+	default:
+		problems = append(problems, fmt.Sprintf("%s `%s' must be one of %s, %s or %s", SETTING_ATTACH,
+			cfg.AttachReport, ATTACH_NONE, ATTACH_HTML, ATTACH_JSON))
+	}
+
+	if ca := ms.CACert; ca != "" {
+		if _, err := os.Stat(ca); err != nil {
+			problems = append(problems, fmt.Sprintf("%s `%s' can't be read: %s", SETTING_MAIL_CA_CERT, ca, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Settings which used to be read where they were needed are decoded into the
+// Config, with the defaults for the absent ones.
+func TestNewConfig(t *testing.T) {
+	cfg, err := NewConfig(map[string]string{
+		SETTING_MAIL_HOST:             "smtp.example.org:465",
+		SETTING_MAIL_SEC:              MAIL_SECURITY_TLS,
+		SETTING_OAUTH_CLIENT:          "client",
+		SETTING_WINDOW:                "12h",
+		SETTING_AUTH_IGNORE:           "192.0.2.1, 2001:db8::/32",
+		SETTING_AUTH_PATTERN + ".b":   `Bad user (?P<user>\S+) from (?P<ip>\S+)`,
+		SETTING_AUTH_PATTERN + ".a":   `Nope, (?P<ip>\S+)`,
+		SETTING_COMMAND_PREFIX + "up": "uptime",
+		SETTING_DISK_EXCLUDE:          "/boot",
+		SETTING_WEBHOOK_URL:           "https://example.org/hook",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Mail.MailHost != "smtp.example.org:465" || cfg.Mail.Security != MAIL_SECURITY_TLS || cfg.Mail.OAuth.ClientID != "client" {
+		t.Errorf("expected the mail settings, got %+v", cfg.Mail)
+	}
+	if cfg.Mail.Retries != defaultMailRetries || cfg.Mail.DialTimeout != defaultMailDialTimeout {
+		t.Errorf("expected the default retries and dial timeout, got %d and %s", cfg.Mail.Retries, cfg.Mail.DialTimeout)
+	}
+	if cfg.AuthLog.LogFile != defaultAuthLog || cfg.AuthLog.Window != 12*time.Hour {
+		t.Errorf("expected the default auth log, scoped like the report, got %+v", cfg.AuthLog)
+	}
+	if want := []string{"192.0.2.1", "2001:db8::/32"}; !reflect.DeepEqual(cfg.AuthLog.IgnoreIPs, want) {
+		t.Errorf("expected %v, got %v", want, cfg.AuthLog.IgnoreIPs)
+	}
+	if len(cfg.AuthLog.Patterns) != 2 || !strings.HasPrefix(cfg.AuthLog.Patterns[0], "Bad user") {
+		t.Errorf("expected both patterns, sorted, got %v", cfg.AuthLog.Patterns)
+	}
+	if want := []CustomCommand{{Label: "up", Command: "uptime"}}; !reflect.DeepEqual(cfg.Commands, want) {
+		t.Errorf("expected %v, got %v", want, cfg.Commands)
+	}
+	if cfg.DfCommand != defaultDfCommand || cfg.DfTimeout != defaultDfTimeout || !reflect.DeepEqual(cfg.DiskExclude, []string{"/boot"}) {
+		t.Errorf("expected the df settings, got %s, %s and %v", cfg.DfCommand, cfg.DfTimeout, cfg.DiskExclude)
+	}
+	if !reflect.DeepEqual(cfg.ExtIpProviders, defaultExtIPProviders) || cfg.ExtIpTimeout != defaultExtIPTimeout {
+		t.Errorf("expected the default IP providers, got %v and %s", cfg.ExtIpProviders, cfg.ExtIpTimeout)
+	}
+	hook, err := WebhookNotifierFromConfig(cfg)
+	if err != nil || hook == nil || hook.Timeout != defaultWebhookTimeout {
+		t.Errorf("expected a webhook with the default timeout, got %+v (%v)", hook, err)
+	}
+}
+
+// A setting which can't be decoded is an error, rather than silently the
+// default.
+func TestNewConfigInvalid(t *testing.T) {
+	for _, key := range []string{SETTING_IP_TIMEOUT, SETTING_AUTH_WINDOW, SETTING_RATE_WINDOW, SETTING_DF_TIMEOUT, SETTING_HOOK_TIMEOUT, SETTING_MAIL_DELAY} {
+		if _, err := NewConfig(map[string]string{key: "soon"}); err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s: expected an error naming the setting, got %v", key, err)
+		}
+	}
+	if _, err := NewConfig(map[string]string{SETTING_MAIL_RETRIES: "a few"}); err == nil {
+		t.Error("expected an error for retries which aren't a number")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	defaults := DefaultSettings()
+	cfg, err := NewConfig(map[string]string{
+		SETTING_MAIL_HOST: "smtp.example.org",
+		SETTING_MAIL_FROM: defaults[SETTING_MAIL_FROM],
+		SETTING_PASSWORD:  defaults[SETTING_PASSWORD],
+		SETTING_TO_ADDR:   "not an address",
+		SETTING_MAIL_AUTH: MAIL_AUTH_XOAUTH2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ValidateConfig(cfg)
+	if err == nil {
+		t.Fatal("expected an invalid configuration")
+	}
+	for _, want := range []string{
+		"MailTo is required",
+		"FromAddress is required",
+		"MailFrom is still set to its placeholder",
+		"Password is still set to its placeholder\n",
+		"MailHost `smtp.example.org' is not in the host:port format",
+		"ToAddress `not an address' is not a valid email address",
+		"UserName is required for xoauth2",
+	} {
+		if !strings.Contains(err.Error()+"\n", want) {
+			t.Errorf("expected %q in %s", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), defaults[SETTING_PASSWORD]) {
+		t.Error("expected the placeholder password not to be in the error")
+	}
+
+	cfg.DeliveryMethod = DELIVERY_SENDMAIL
+	cfg.Mail = MailSettings{MailFrom: "Stats <stats@example.org>", MailTo: "me@example.org", FromAddress: "stats@example.org", ToAddress: "me@example.org"}
+	if err = ValidateConfig(cfg); err != nil {
+		t.Errorf("expected a valid configuration for sendmail, got %s", err)
+	}
+}
+
+// TOML and YAML files are written by their encoders, with the lists and
+// numbers as such, and strings with control characters read back the same.
+func TestSaveSettingsFile(t *testing.T) {
+	settings := DefaultSettings()
+	settings[SETTING_MAIL_SUBJECT] = "Report\a\x00 \"{{ .Hostname }}\""
+	settings[SETTING_DISK_EXCLUDE] = "/boot, /snap"
+	settings[SETTING_COMMAND_PREFIX+"up"] = "uptime"
+
+	for _, name := range []string{"config.toml", "config.yaml"} {
+		file := filepath.Join(t.TempDir(), name)
+		if err := saveSettingsFile(file, settings); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), "/snap") || strings.Contains(string(content), "/boot, /snap") {
+			t.Errorf("%s: expected the disks as a list, got\n%s", name, content)
+		}
+
+		loaded, err := loadSettingsFile(file)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if got := loaded[SETTING_MAIL_SUBJECT]; got != settings[SETTING_MAIL_SUBJECT] {
+			t.Errorf("%s: expected %q, got %q", name, settings[SETTING_MAIL_SUBJECT], got)
+		}
+		if got := loaded[SETTING_COMMAND_PREFIX+"up"]; got != "uptime" {
+			t.Errorf("%s: expected the custom command, got %q", name, got)
+		}
+		cfg, err := NewConfig(loaded)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if want := []string{"/boot", "/snap"}; !reflect.DeepEqual(cfg.DiskExclude, want) {
+			t.Errorf("%s: expected %v, got %v", name, want, cfg.DiskExclude)
+		}
+	}
+}
+
+// Empty settings are in effect with their default, both when decoded and
+// when printed.
+func TestEffectiveSettings(t *testing.T) {
+	settings := map[string]string{SETTING_DF_FLAGS: "", SETTING_MAIL_SUBJECT: " ", SETTING_WINDOW: "12h"}
+	effective := EffectiveSettings(settings)
+	defaults := DefaultSettings()
+	for _, key := range []string{SETTING_DF_FLAGS, SETTING_MAIL_SUBJECT} {
+		if effective[key] != defaults[key] {
+			t.Errorf("%s: expected the default %q, got %q", key, defaults[key], effective[key])
+		}
+	}
+	if effective[SETTING_WINDOW] != "12h" {
+		t.Errorf("expected the configured window, got %q", effective[SETTING_WINDOW])
+	}
+
+	cfg, err := NewConfig(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DfFlags != effective[SETTING_DF_FLAGS] || cfg.Mail.MailSubject != effective[SETTING_MAIL_SUBJECT] {
+		t.Errorf("expected the decoded settings to be the effective ones, got %q and %q", cfg.DfFlags, cfg.Mail.MailSubject)
+	}
+}
@@ -0,0 +1,142 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/crazy2be/ini"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// The formats of the configuration file, by the extension of the file. Any
+// other extension, or none at all like ~/.config/stats/config, is ini.
+const (
+	CONFIG_INI  = "ini"
+	CONFIG_TOML = "toml"
+	CONFIG_YAML = "yaml"
+)
+
+// Returns the format of the configuration file, by its extension.
+func ConfigFormat(configFile string) string {
+	switch strings.ToLower(path.Ext(configFile)) {
+	case ".toml":
+		return CONFIG_TOML
+	case ".yaml", ".yml":
+		return CONFIG_YAML
+	}
+
+	return CONFIG_INI
+}
+
+// Loads the settings from the configuration file, in the format belonging
+// to its extension. TOML and YAML files may group settings in tables, which
+// are flattened by prefixing the keys with the name of the table, so
+//
+//	[Mail]
+//	Host = "smtp.example.org"
+//	To = ["me@example.org", "you@example.org"]
+//
+// is the same as MailHost and MailTo in an ini file. Lists are joined with
+// commas, like the list settings in an ini file.
+func loadSettingsFile(configFile string) (map[string]string, error) {
+	format := ConfigFormat(configFile)
+	if format == CONFIG_INI {
+		return ini.Load(configFile)
+	}
+
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read `%s': %s", configFile, err)
+	}
+
+	values := make(map[string]interface{})
+	if format == CONFIG_TOML {
+		err = toml.Unmarshal(content, &values)
+	} else {
+		err = yaml.Unmarshal(content, &values)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s configuration file `%s': %s", format, configFile, err)
+	}
+
+	settings := make(map[string]string)
+	if err = flattenSettings(settings, "", values); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file `%s': %s", configFile, err)
+	}
+
+	return settings, nil
+}
+
+// Flattens the nested values into the settings, see loadSettingsFile.
+func flattenSettings(settings map[string]string, prefix string, values map[string]interface{}) error {
+	for key, val := range values {
+		switch v := val.(type) {
+		case map[string]interface{}:
+			if err := flattenSettings(settings, prefix+key, v); err != nil {
+				return err
+			}
+		case []interface{}:
+			elems := make([]string, 0, len(v))
+			for _, elem := range v {
+				switch elem.(type) {
+				case map[string]interface{}, []interface{}:
+					return fmt.Errorf("the list %s can only hold plain values", prefix+key)
+				}
+				elems = append(elems, fmt.Sprint(elem))
+			}
+			settings[prefix+key] = strings.Join(elems, ",")
+		case nil:
+			settings[prefix+key] = ""
+		default:
+			settings[prefix+key] = fmt.Sprint(v)
+		}
+	}
+
+	return nil
+}
+
+// Saves the settings to the configuration file, in the format belonging to
+// its extension. TOML and YAML files get the flat keys of an ini file, sorted
+// by name, with the values as they're decoded into the Config: lists as
+// lists, numbers as numbers. Settings which aren't part of the Config, like
+// the custom commands, and empty ones are saved as strings.
+func saveSettingsFile(configFile string, settings map[string]string) error {
+	format := ConfigFormat(configFile)
+	if format == CONFIG_INI {
+		return ini.Save(configFile, settings)
+	}
+
+	cfg, err := NewConfig(settings)
+	if err != nil {
+		return err
+	}
+	typed := make(map[string]interface{})
+	encodeSettings(reflect.ValueOf(cfg), typed)
+
+	values := make(map[string]interface{}, len(settings))
+	for key, val := range settings {
+		values[key] = val
+		if t, ok := typed[key]; ok && strings.TrimSpace(val) != "" {
+			values[key] = t
+		}
+	}
+
+	// both encoders sort the keys of maps by themselves.
+	var content []byte
+	if format == CONFIG_TOML {
+		buf := &bytes.Buffer{}
+		if err = toml.NewEncoder(buf).Encode(values); err != nil {
+			return fmt.Errorf("Unable to encode the configuration: %s", err)
+		}
+		content = buf.Bytes()
+	} else if content, err = yaml.Marshal(values); err != nil {
+		return fmt.Errorf("Unable to encode the configuration: %s", err)
+	}
+
+	return ioutil.WriteFile(configFile, content, os.FileMode(0600))
+}
@@ -0,0 +1,172 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the disk I/O statistics.
+const (
+	// time between the two samples of /proc/diskstats
+	diskIOInterval = time.Second
+	// the kernel counts sectors of 512 bytes, whatever the disk uses
+	diskSectorSize = 512
+)
+
+// The I/O activity of a block device, averaged over the sample interval.
+// Free space doesn't show a disk which is busy all the time, this does.
+type DiskIO struct {
+	Device string `json:"device"`
+	// Completed reads and writes per second
+	ReadIOPS  float64 `json:"read_iops"`
+	WriteIOPS float64 `json:"write_iops"`
+	// Bytes read and written per second
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	// Percentage of the time the device was busy with I/O. Devices serving
+	// requests in parallel, like SSDs, can be busy without being saturated,
+	// so this is approximate.
+	Utilization float64 `json:"utilization"`
+}
+
+// Returns a simple string representation of this struct.
+func (d DiskIO) String() string {
+	return fmt.Sprintf("%s: %.0f reads/s (%s/s), %.0f writes/s (%s/s), %.0f%% busy", d.Device,
+		d.ReadIOPS, formatBytes(d.ReadBytes), d.WriteIOPS, formatBytes(d.WriteBytes), d.Utilization)
+}
+
+// The counters of a block device in /proc/diskstats.
+type diskCounters struct {
+	reads, readSectors   uint64
+	writes, writeSectors uint64
+	// milliseconds spent doing I/O
+	busy uint64
+}
+
+// Gets the I/O activity of the block devices, by reading /proc/diskstats
+// twice, diskIOInterval apart. Partitions, loop and ram devices are skipped,
+// unless all is set: the activity of a partition is part of its disk's.
+func GetDiskIO(ctx context.Context, all bool) ([]DiskIO, error) {
+	sample, err := readDiskStats(all)
+	if err != nil {
+		return nil, err
+	}
+	before := make(map[string]diskCounters, len(sample))
+	for _, dev := range sample {
+		before[dev.name] = dev.diskCounters
+	}
+	start := time.Now()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(diskIOInterval):
+	}
+
+	after, err := readDiskStats(all)
+	if err != nil {
+		return nil, err
+	}
+	seconds := time.Since(start).Seconds()
+
+	devices := make([]DiskIO, 0, len(after))
+	for _, dev := range after {
+		prev, ok := before[dev.name]
+		// a device which appeared in between has nothing to compare with.
+		if !ok {
+			continue
+		}
+		cur := dev.diskCounters
+		util := float64(cur.busy-prev.busy) / (seconds * 10)
+		if util > 100 {
+			util = 100
+		}
+		devices = append(devices, DiskIO{
+			Device:      dev.name,
+			ReadIOPS:    float64(cur.reads-prev.reads) / seconds,
+			WriteIOPS:   float64(cur.writes-prev.writes) / seconds,
+			ReadBytes:   uint64(float64((cur.readSectors-prev.readSectors)*diskSectorSize) / seconds),
+			WriteBytes:  uint64(float64((cur.writeSectors-prev.writeSectors)*diskSectorSize) / seconds),
+			Utilization: util,
+		})
+	}
+
+	return devices, nil
+}
+
+// A block device with its counters, in the order of /proc/diskstats.
+type namedDiskCounters struct {
+	name string
+	diskCounters
+}
+
+// Reads the counters of the block devices from /proc/diskstats.
+func readDiskStats(all bool) ([]namedDiskCounters, error) {
+	stats, err := ioutil.ReadFile("/proc/diskstats")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read `/proc/diskstats': %s", err)
+	}
+
+	return parseDiskStats(string(stats), all), nil
+}
+
+// Parses /proc/diskstats, which has a line per device like
+//
+//	8       0 sda 4310 1066 318370 1820 3042 2904 102880 3931 0 3768 5752 ...
+//
+// with the reads, sectors read, writes, sectors written and the milliseconds
+// spent doing I/O in the 4th, 6th, 8th, 10th and 13th field.
+func parseDiskStats(stats string, all bool) []namedDiskCounters {
+	devices := make([]namedDiskCounters, 0)
+	for _, line := range strings.Split(stats, "\n") {
+		fld := strings.Fields(line)
+		if len(fld) < 13 {
+			continue
+		}
+		if !all && !isWholeDisk(fld[2]) {
+			continue
+		}
+
+		var counters [5]uint64
+		valid := true
+		for i, field := range []int{3, 5, 7, 9, 12} {
+			n, err := strconv.ParseUint(fld[field], 10, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			counters[i] = n
+		}
+		if !valid {
+			continue
+		}
+		devices = append(devices, namedDiskCounters{fld[2], diskCounters{
+			reads:        counters[0],
+			readSectors:  counters[1],
+			writes:       counters[2],
+			writeSectors: counters[3],
+			busy:         counters[4],
+		}})
+	}
+
+	return devices
+}
+
+// Returns whether the device is a whole disk worth reporting. Only whole
+// disks have a directory in /sys/block, partitions don't. Loop, ram and zram
+// devices do, but they're not disks. Slashes in device names, like
+// cciss/c0d0, are exclamation marks in /sys/block.
+func isWholeDisk(name string) bool {
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+		return false
+	}
+	_, err := os.Stat(filepath.Join("/sys/block", strings.ReplaceAll(name, "/", "!")))
+
+	return err == nil
+}
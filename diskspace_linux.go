@@ -0,0 +1,87 @@
+//go:build linux
+
+package stats
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Gets the free disk space without the df utility, by calling statfs on
+// every mount point listed in /proc/mounts. Pseudo file systems reporting
+// zero blocks (proc, sysfs, cgroups and the like) are skipped, just like df
+// does by default. The inode usage is taken from the same statfs call.
+func statfsDiskSpace() ([]FsEntry, error) {
+	mounts, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read /proc/mounts: %s", err)
+	}
+
+	mpEntries := make([]FsEntry, 0)
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fld := strings.Fields(line)
+		if len(fld) < 2 || fld[0] == "none" {
+			continue
+		}
+
+		st := unix.Statfs_t{}
+		if err := unix.Statfs(fld[1], &st); err != nil || st.Blocks == 0 {
+			continue
+		}
+
+		bsize := uint64(st.Frsize)
+		if bsize == 0 {
+			bsize = uint64(st.Bsize)
+		}
+		size := st.Blocks * bsize
+		avail := st.Bavail * bsize
+		used := (st.Blocks - st.Bfree) * bsize
+
+		fs := FsEntry{}
+		fs.FileSystem = fld[0]
+		fs.SizeBytes = size
+		fs.UsedBytes = used
+		fs.AvailBytes = avail
+		fs.Size = formatBytes(size)
+		fs.Used = formatBytes(used)
+		fs.Avail = formatBytes(avail)
+		fs.UsePercentage = usePercentage(used, avail)
+		fs.MountPoint = fld[1]
+		if len(fld) > 2 {
+			fs.Type = fld[2]
+		}
+		// some file systems (like btrfs) have no fixed amount of inodes.
+		if st.Files > 0 {
+			fs.Inodes = strconv.FormatUint(st.Files, 10)
+			fs.IUsed = strconv.FormatUint(st.Files-st.Ffree, 10)
+			fs.IFree = strconv.FormatUint(st.Ffree, 10)
+			fs.IUsePercentage = usePercentage(st.Files-st.Ffree, st.Ffree)
+		}
+		fs.parsePercentages()
+
+		mpEntries = append(mpEntries, fs)
+	}
+
+	return mpEntries, nil
+}
+
+// Returns the file system types by mount point, from /proc/mounts. With
+// stacked mounts, the type of the top one wins, like df reports it.
+func mountTypes() map[string]string {
+	types := make(map[string]string)
+	mounts, err := ioutil.ReadFile("/proc/mounts")
+	if err != nil {
+		return types
+	}
+
+	for _, line := range strings.Split(string(mounts), "\n") {
+		if fld := strings.Fields(line); len(fld) > 2 {
+			types[fld[1]] = fld[2]
+		}
+	}
+
+	return types
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+
+package stats
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The statfs fallback is only implemented for Linux, since it needs
+// /proc/mounts to find out what is mounted.
+func statfsDiskSpace() ([]FsEntry, error) {
+	return nil, fmt.Errorf("No df binary found, and no statfs fallback on %s", runtime.GOOS)
+}
+
+// Without /proc/mounts, the file system types are unknown.
+func mountTypes() map[string]string {
+	return map[string]string{}
+}
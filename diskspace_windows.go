@@ -0,0 +1,109 @@
+//go:build windows
+
+package stats
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows"
+)
+
+// Gets the free disk space without the df utility, which Windows doesn't
+// have, by calling GetDiskFreeSpaceEx on every drive. Drives which aren't
+// ready, like an empty DVD drive, are skipped. NTFS has no fixed amount of
+// inodes, so there's no inode usage.
+func statfsDiskSpace() ([]FsEntry, error) {
+	drives, err := logicalDrives()
+	if err != nil {
+		return nil, err
+	}
+
+	mpEntries := make([]FsEntry, 0, len(drives))
+	for _, drive := range drives {
+		root, err := windows.UTF16PtrFromString(drive)
+		if err != nil {
+			continue
+		}
+		var avail, size, free uint64
+		if err := windows.GetDiskFreeSpaceEx(root, &avail, &size, &free); err != nil || size == 0 {
+			continue
+		}
+		used := size - free
+
+		fs := FsEntry{}
+		fs.FileSystem, fs.Type = volumeInformation(drive)
+		if fs.FileSystem == "" {
+			fs.FileSystem = drive
+		}
+		fs.SizeBytes = size
+		fs.UsedBytes = used
+		fs.AvailBytes = avail
+		fs.Size = formatBytes(size)
+		fs.Used = formatBytes(used)
+		fs.Avail = formatBytes(avail)
+		fs.UsePercentage = usePercentage(used, avail)
+		fs.MountPoint = drive
+		fs.parsePercentages()
+
+		mpEntries = append(mpEntries, fs)
+	}
+
+	return mpEntries, nil
+}
+
+// Returns the file system types by drive, like NTFS for C:\.
+func mountTypes() map[string]string {
+	types := make(map[string]string)
+	drives, err := logicalDrives()
+	if err != nil {
+		return types
+	}
+
+	for _, drive := range drives {
+		if _, fstype := volumeInformation(drive); fstype != "" {
+			types[drive] = fstype
+		}
+	}
+
+	return types
+}
+
+// Returns the root directories of the drives, like C:\ and D:\.
+func logicalDrives() ([]string, error) {
+	buf := make([]uint16, 256)
+	n, err := windows.GetLogicalDriveStrings(uint32(len(buf)), &buf[0])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list the drives: %s", err)
+	}
+
+	// the drives are separated, and ended, by a NUL.
+	drives := make([]string, 0)
+	start := 0
+	for i := 0; i < int(n) && i < len(buf); i++ {
+		if buf[i] == 0 {
+			if i > start {
+				drives = append(drives, windows.UTF16ToString(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+
+	return drives, nil
+}
+
+// Returns the label and the file system type of the volume at the root of a
+// drive, empty when they're unknown.
+func volumeInformation(drive string) (string, string) {
+	root, err := windows.UTF16PtrFromString(drive)
+	if err != nil {
+		return "", ""
+	}
+
+	label := make([]uint16, windows.MAX_PATH+1)
+	fstype := make([]uint16, windows.MAX_PATH+1)
+	err = windows.GetVolumeInformation(root, &label[0], uint32(len(label)), nil, nil, nil, &fstype[0], uint32(len(fstype)))
+	if err != nil {
+		return "", ""
+	}
+
+	return windows.UTF16ToString(label), windows.UTF16ToString(fstype)
+}
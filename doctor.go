@@ -0,0 +1,58 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+)
+
+// A check of the environment, to find out whether a report can be collected
+// and delivered before trusting it to cron.
+type Check struct {
+	Name string
+	// Whether the report is of no use when the check fails
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Returns the checks for the given configuration. They probe what the collectors
+// and the mail delivery need, without sending anything. The mail checks are
+// only there when mail is configured, that is, when there is a MailHost or
+// a Maildir.
+func DoctorChecks(cfg Config) []Check {
+	checks := []Check{
+		{"uptime", true, func(ctx context.Context) error {
+			_, err := GetUptime()
+			return err
+		}},
+		{"df", true, func(ctx context.Context) error {
+			_, err := GetFreeDiskSpaceFromConfig(ctx, cfg)
+			return err
+		}},
+		{"ip", false, func(ctx context.Context) error {
+			_, err := GetExtIPAddressFromConfig(ctx, cfg)
+			return err
+		}},
+		{"authlog", false, func(ctx context.Context) error {
+			_, err := AnalyzeAuthLog(ctx, cfg.AuthLog)
+			return err
+		}},
+	}
+
+	if cfg.Mail.MailHost == "" && cfg.DeliveryMethod != DELIVERY_MAILDIR && cfg.DeliveryMethod != DELIVERY_SENDMAIL {
+		return checks
+	}
+
+	checks = append(checks,
+		Check{"config", true, func(ctx context.Context) error {
+			return ValidateConfig(cfg)
+		}},
+		Check{"mail", true, func(ctx context.Context) error {
+			if err := MailNotifierFromConfig(cfg).Verify(); err != nil {
+				return fmt.Errorf("Unable to deliver mail: %s", err)
+			}
+			return nil
+		}},
+	)
+
+	return checks
+}
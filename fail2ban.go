@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Amount of recent ban/unban actions to keep for the report.
+const fail2banRecentActions = 10
+
+// A single ban or unban action as logged by fail2ban.
+type Fail2banAction struct {
+	// Time the action was logged
+	Time time.Time `json:"time"`
+	// Name of the jail, e.g. sshd
+	Jail string `json:"jail"`
+	// Either "Ban" or "Unban"
+	Action string `json:"action"`
+	// The ip address which was (un)banned
+	IPAddress string `json:"ip_address"`
+}
+
+// Returns a simple string representation of this struct.
+func (a Fail2banAction) String() string {
+	return fmt.Sprintf("%s [%s] %s %s", a.Time.Format("2006-01-02 15:04:05"), a.Jail, a.Action, a.IPAddress)
+}
+
+// An ip address which is currently banned in a jail.
+type Fail2banBan struct {
+	Jail      string    `json:"jail"`
+	IPAddress string    `json:"ip_address"`
+	BannedAt  time.Time `json:"banned_at"`
+}
+
+// Returns a simple string representation of this struct.
+func (b Fail2banBan) String() string {
+	return fmt.Sprintf("[%s] %s (since %s)", b.Jail, b.IPAddress, b.BannedAt.Format("2006-01-02 15:04:05"))
+}
+
+// Result of analyzing the fail2ban log: the bans which are still active, and
+// the most recent ban/unban actions (newest first).
+type Fail2banReport struct {
+	Active []Fail2banBan    `json:"active"`
+	Recent []Fail2banAction `json:"recent"`
+}
+
+// Matches the ban and unban actions in the fail2ban log, with the time, the
+// jail, the action and the IP address.
+var fail2banActionRex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}),\d+ fail2ban\.actions.*\[([^\]]+)\]\s+(?:Restore )?(Ban|Unban) (\S+)`)
+
+// Analyzes the fail2ban log file (typically /var/log/fail2ban.log) to find out
+// which ip addresses are currently banned per jail, and which ban/unban actions
+// happened recently. Lines are expected in the default fail2ban format:
+//
+//	2014-01-15 10:23:45,123 fail2ban.actions [1234]: NOTICE [sshd] Ban 1.2.3.4
+//
+// Bans restored after a fail2ban restart ("Restore Ban") are counted as bans.
+func AnalyzeFail2banLog(infile string) (*Fail2banReport, error) {
+	f, err := os.Open(infile)
+	if err != nil {
+		return nil, logOpenError(infile, err)
+	}
+	defer f.Close()
+
+	// map of jail names to a map of banned ip addresses and their ban time.
+	active := make(map[string]map[string]time.Time)
+	// only the last few actions are kept, so the log is scanned line by line
+	// and even a huge log doesn't have to fit in memory.
+	actions := make([]Fail2banAction, 0, 2*fail2banRecentActions)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAuthLogLine)
+	for scanner.Scan() {
+		what := fail2banActionRex.FindStringSubmatch(scanner.Text())
+		if what == nil {
+			continue
+		}
+
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", what[1], time.Local)
+		if err != nil {
+			continue
+		}
+
+		action := Fail2banAction{t, what[2], what[3], what[4]}
+		if len(actions) == cap(actions) {
+			actions = append(actions[:0], actions[len(actions)-fail2banRecentActions:]...)
+		}
+		actions = append(actions, action)
+
+		if active[action.Jail] == nil {
+			active[action.Jail] = make(map[string]time.Time)
+		}
+		if action.Action == "Ban" {
+			active[action.Jail][action.IPAddress] = action.Time
+		} else {
+			delete(active[action.Jail], action.IPAddress)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read `%s': %s", infile, err)
+	}
+
+	report := &Fail2banReport{}
+	for jail, ips := range active {
+		for ip, t := range ips {
+			report.Active = append(report.Active, Fail2banBan{jail, ip, t})
+		}
+	}
+	// sort by jail, then by most recent ban first.
+	sort.Slice(report.Active, func(i, j int) bool {
+		if report.Active[i].Jail != report.Active[j].Jail {
+			return report.Active[i].Jail < report.Active[j].Jail
+		}
+		return report.Active[i].BannedAt.After(report.Active[j].BannedAt)
+	})
+
+	// keep the last few actions, newest first.
+	for i := len(actions) - 1; i >= 0 && len(report.Recent) < fail2banRecentActions; i-- {
+		report.Recent = append(report.Recent, actions[i])
+	}
+
+	return report, nil
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The log is scanned line by line: bans lifted later aren't active, and only
+// the last few actions are kept, newest first.
+func TestAnalyzeFail2banLog(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fail2ban.log")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(w, "2024-01-15 10:%02d:%02d,123 fail2ban.actions [1234]: NOTICE [sshd] Ban 192.0.2.%d\n", i/60%60, i%60, i%200)
+		fmt.Fprintf(w, "2024-01-15 10:%02d:%02d,456 fail2ban.filter [1234]: INFO [sshd] Found 192.0.2.%d\n", i/60%60, i%60, i%200)
+		if i%200 != 7 {
+			fmt.Fprintf(w, "2024-01-15 10:%02d:%02d,789 fail2ban.actions [1234]: NOTICE [sshd] Unban 192.0.2.%d\n", i/60%60, i%60, i%200)
+		}
+	}
+	fmt.Fprintln(w, "2024-01-15 11:00:00,000 fail2ban.actions [1234]: NOTICE [recidive] Restore Ban 198.51.100.1")
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	report, err := AnalyzeFail2banLog(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Active) != 2 || report.Active[0].IPAddress != "198.51.100.1" || report.Active[1].IPAddress != "192.0.2.7" {
+		t.Errorf("expected 198.51.100.1 and 192.0.2.7 to be banned, got %v", report.Active)
+	}
+	if len(report.Recent) != fail2banRecentActions {
+		t.Fatalf("expected %d recent actions, got %d", fail2banRecentActions, len(report.Recent))
+	}
+	if got := report.Recent[0]; got.Jail != "recidive" || got.Action != "Ban" {
+		t.Errorf("expected the restored ban first, got %s", got)
+	}
+	if got := report.Recent[1]; got.Action != "Unban" || got.IPAddress != "192.0.2.199" {
+		t.Errorf("expected the last unban second, got %s", got)
+	}
+
+	if _, err := AnalyzeFail2banLog(filepath.Join(t.TempDir(), "missing.log")); err == nil {
+		t.Error("expected an error for a missing log")
+	}
+}
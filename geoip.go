@@ -0,0 +1,35 @@
+package stats
+
+import (
+	"fmt"
+	"github.com/oschwald/geoip2-golang"
+	"net"
+)
+
+// Annotates the failures with the country and city of their IP address, as
+// found in the MaxMind database at dbPath. IP addresses which can't be found
+// in the database are left as they are. An error is only returned when the
+// database itself can't be opened, in which case no failure is annotated.
+func EnrichGeoIP(failures []AuthFailure, dbPath string) error {
+	db, err := geoip2.Open(dbPath)
+	if err != nil {
+		return fmt.Errorf("Unable to open GeoIP database `%s': %s", dbPath, err)
+	}
+	defer db.Close()
+
+	for i := range failures {
+		ip := net.ParseIP(failures[i].IPAddress)
+		if ip == nil {
+			continue
+		}
+
+		record, err := db.City(ip)
+		if err != nil {
+			continue
+		}
+		failures[i].Country = record.Country.Names["en"]
+		failures[i].City = record.City.Names["en"]
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the history of key metrics.
+const (
+	// days of history to keep, when none is configured
+	defaultHistoryDays = 30
+	// amount of values shown per trend, the current one included
+	trendPoints = 5
+)
+
+// A compact record of the key metrics of a single report, kept in the
+// history file as a line of JSON.
+type HistoryRecord struct {
+	Time time.Time `json:"time"`
+	// The use percentage of every mount point
+	Disks map[string]int `json:"disks,omitempty"`
+	// The load averages over the last 1, 5 and 15 minutes
+	Load []float64 `json:"load,omitempty"`
+	// The memory use percentage, nil when unknown
+	MemUsed *float64 `json:"mem_used,omitempty"`
+	// The amount of failed logins, nil when unknown
+	FailedLogins *int `json:"failed_logins,omitempty"`
+}
+
+// Creates the history record of the report. Metrics which could not be
+// collected are left out.
+func NewHistoryRecord(report *ReportData) HistoryRecord {
+	rec := HistoryRecord{Time: report.Time, Disks: make(map[string]int)}
+	for _, fs := range report.FreeSpace {
+		if fs.UsePercent >= 0 {
+			rec.Disks[fs.MountPoint] = fs.UsePercent
+		}
+	}
+	if report.Load != nil {
+		rec.Load = []float64{report.Load.Load1, report.Load.Load5, report.Load.Load15}
+	}
+	if report.Memory != nil {
+		used := report.Memory.UsedPercentage()
+		rec.MemUsed = &used
+	}
+	if _, failed := report.Errors["authlog"]; !failed {
+		total := 0
+		for _, f := range report.Failures {
+			total += f.Failures
+		}
+		rec.FailedLogins = &total
+	}
+
+	return rec
+}
+
+// Returns the path of the history file belonging to the configuration file,
+// which is next to it, named like the state file (see StateFile).
+func HistoryFile(configFile string) string {
+	dir, name := path.Split(configFile)
+	if name == "config" {
+		return path.Join(dir, "history")
+	}
+
+	return path.Join(dir, strings.TrimSuffix(name, path.Ext(name))+".history")
+}
+
+// Loads the history records from the given file, the oldest first. A missing
+// file is not an error, there is no history before the first run. Lines which
+// can't be parsed are skipped.
+func LoadHistory(file string) ([]HistoryRecord, error) {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return []HistoryRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read history file `%s': %s", file, err)
+	}
+
+	records := make([]HistoryRecord, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, maxAuthLogLine)
+	for scanner.Scan() {
+		rec := HistoryRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err == nil {
+			records = append(records, rec)
+		}
+	}
+
+	return records, nil
+}
+
+// Appends the record to the history file, and prunes the records older than
+// maxAge, and the oldest ones beyond maxEntries when that's over zero. The
+// file is rewritten as a whole, so it never grows beyond those limits.
+func AppendHistory(file string, rec HistoryRecord, maxAge time.Duration, maxEntries int) error {
+	records, err := LoadHistory(file)
+	if err != nil {
+		return err
+	}
+	records = append(records, rec)
+
+	kept := make([]HistoryRecord, 0, len(records))
+	for _, r := range records {
+		if rec.Time.Sub(r.Time) < maxAge {
+			kept = append(kept, r)
+		}
+	}
+	if maxEntries > 0 && len(kept) > maxEntries {
+		kept = kept[len(kept)-maxEntries:]
+	}
+
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	for _, r := range kept {
+		if err = enc.Encode(r); err != nil {
+			return fmt.Errorf("Unable to encode history: %s", err)
+		}
+	}
+
+	// write the new history next to the old one, so a crash halfway
+	// doesn't lose it.
+	if err = os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Failed to create history directory `%s'", path.Dir(file))
+	}
+	if err = ioutil.WriteFile(file+".tmp", buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("Unable to write history file `%s': %s", file, err)
+	}
+	if err = os.Rename(file+".tmp", file); err != nil {
+		return fmt.Errorf("Unable to write history file `%s': %s", file, err)
+	}
+
+	return nil
+}
+
+// Appends the record of the report to the history file, with the limits from
+// the configuration. HistoryDays of zero disables the history, MaxHistoryAge
+// keeps records for a finer age than whole days.
+func AppendHistoryFromConfig(file string, report *ReportData, cfg Config) error {
+	if cfg.HistoryDays <= 0 {
+		return nil
+	}
+
+	maxAge := time.Duration(cfg.HistoryDays) * 24 * time.Hour
+	if cfg.MaxHistoryAge > 0 {
+		maxAge = cfg.MaxHistoryAge
+	}
+
+	return AppendHistory(file, NewHistoryRecord(report), maxAge, cfg.MaxHistoryEntries)
+}
+
+// The values of a metric over the last few reports, the current one last.
+type Trend struct {
+	// What's trending, like `disk /' or `load'
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+	// The unit after the values, like %
+	Unit string `json:"unit"`
+}
+
+// Returns the trend as the values separated by arrows, like `88→89→91%'.
+func (t Trend) String() string {
+	return strings.Join(t.Values, "→") + t.Unit
+}
+
+// Builds the trends of the key metrics from the history and the report. Only
+// metrics which are known in the report and in at least one of the records
+// before it have a trend.
+func BuildTrends(history []HistoryRecord, report *ReportData) []Trend {
+	if len(history) > trendPoints-1 {
+		history = history[len(history)-(trendPoints-1):]
+	}
+	records := append(append([]HistoryRecord(nil), history...), NewHistoryRecord(report))
+
+	trends := make([]Trend, 0)
+	add := func(name, unit string, value func(HistoryRecord) (string, bool)) {
+		values := make([]string, 0, len(records))
+		for _, rec := range records {
+			if v, ok := value(rec); ok {
+				values = append(values, v)
+			}
+		}
+		// without the current value or anything before it, there's no trend.
+		if _, ok := value(records[len(records)-1]); ok && len(values) > 1 {
+			trends = append(trends, Trend{name, values, unit})
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, fs := range report.FreeSpace {
+		if seen[fs.MountPoint] {
+			continue
+		}
+		seen[fs.MountPoint] = true
+		mount := fs.MountPoint
+		add("disk "+mount, "%", func(rec HistoryRecord) (string, bool) {
+			pct, ok := rec.Disks[mount]
+			return strconv.Itoa(pct), ok
+		})
+	}
+	add("load", "", func(rec HistoryRecord) (string, bool) {
+		if len(rec.Load) == 0 {
+			return "", false
+		}
+		return strconv.FormatFloat(rec.Load[0], 'f', 2, 64), true
+	})
+	add("memory", "%", func(rec HistoryRecord) (string, bool) {
+		if rec.MemUsed == nil {
+			return "", false
+		}
+		return strconv.FormatFloat(*rec.MemUsed, 'f', 0, 64), true
+	})
+	add("failed logins", "", func(rec HistoryRecord) (string, bool) {
+		if rec.FailedLogins == nil {
+			return "", false
+		}
+		return strconv.Itoa(*rec.FailedLogins), true
+	})
+
+	return trends
+}
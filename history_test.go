@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Every append prunes the history, to the oldest records within the age and
+// to the newest ones within the count, whichever keeps fewer.
+func TestAppendHistory(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) HistoryRecord { return HistoryRecord{Time: start.Add(time.Duration(hour) * time.Hour)} }
+
+	tests := []struct {
+		name       string
+		maxAge     time.Duration
+		maxEntries int
+		first      int
+	}{
+		{"by age", 5 * time.Hour, 0, 5},
+		{"by count", 24 * time.Hour, 3, 7},
+		{"by count within the age", 5 * time.Hour, 3, 7},
+		{"by age within the count", 2 * time.Hour, 3, 8},
+	}
+
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), "history")
+		for hour := 0; hour < 10; hour++ {
+			if err := AppendHistory(file, at(hour), test.maxAge, test.maxEntries); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		records, err := LoadHistory(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 10-test.first || !records[0].Time.Equal(at(test.first).Time) || !records[len(records)-1].Time.Equal(at(9).Time) {
+			t.Errorf("%s: expected the records from hour %d on, got %v", test.name, test.first, records)
+		}
+	}
+}
+
+// MaxHistoryAge keeps the records for less than a day, HistoryDays of zero
+// keeps none at all.
+func TestAppendHistoryFromConfig(t *testing.T) {
+	cfg, err := NewConfig(map[string]string{SETTING_HISTORY_AGE: "90m", SETTING_HISTORY_MAX: "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "history")
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	for hour := 0; hour < 4; hour++ {
+		if err := AppendHistoryFromConfig(file, &ReportData{Time: start.Add(time.Duration(hour) * time.Hour)}, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := LoadHistory(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected the records of the last 90 minutes, got %v", records)
+	}
+
+	cfg.HistoryDays = 0
+	file = filepath.Join(t.TempDir(), "history")
+	if err := AppendHistoryFromConfig(file, &ReportData{Time: start}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = LoadHistory(file); err != nil || len(records) != 0 {
+		t.Errorf("expected no history, got %v (%v)", records, err)
+	}
+}
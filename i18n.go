@@ -0,0 +1,169 @@
+package stats
+
+import (
+	"fmt"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// The translations of the fixed strings in the reports. English is the
+// default, and the fallback for strings and languages without a translation.
+// The keys are the English strings themselves.
+var translations = catalog.NewBuilder(catalog.Fallback(language.English))
+
+// The translations of a single language.
+type translation struct {
+	tag language.Tag
+	// the words for a single unit of time, and for more of them
+	days, hours, minutes, seconds [2]string
+	// everything else, by the English string
+	messages map[string]string
+}
+
+// The languages the reports can be written in. To add one, add its
+// translation here.
+var languages = []translation{
+	{
+		tag:     language.English,
+		days:    [2]string{"day", "days"},
+		hours:   [2]string{"hour", "hours"},
+		minutes: [2]string{"minute", "minutes"},
+		seconds: [2]string{"second", "seconds"},
+	},
+	{
+		tag:     language.Dutch,
+		days:    [2]string{"dag", "dagen"},
+		hours:   [2]string{"uur", "uur"},
+		minutes: [2]string{"minuut", "minuten"},
+		seconds: [2]string{"seconde", "seconden"},
+		messages: map[string]string{
+			"and":                       "en",
+			"less than a second":        "minder dan een seconde",
+			"System":                    "Systeem",
+			"booted":                    "opgestart",
+			"Clock":                     "Klok",
+			"Previous report":           "Vorig rapport",
+			"ago":                       "geleden",
+			"Temperature":               "Temperatuur",
+			"Load average":              "Gemiddelde belasting",
+			"Memory":                    "Geheugen",
+			"Top processes":             "Top processen",
+			"Top processes by CPU":      "Top processen op CPU",
+			"Top processes by memory":   "Top processen op geheugen",
+			"Watched processes":         "Bewaakte processen",
+			"not running":               "draait niet",
+			"started":                   "gestart",
+			"External IP address (WAN)": "Extern IP-adres (WAN)",
+			"Network interfaces":        "Netwerkinterfaces",
+			"Logins":                    "Aanmeldingen",
+			"Failed logins":             "Mislukte aanmeldingen",
+			"Fail2ban bans":             "Fail2ban-blokkades",
+			"Recent ban actions":        "Recente blokkades",
+			"Disk usage":                "Schijfgebruik",
+			"Disk I/O":                  "Schijfactiviteit",
+			"Disk health":               "Schijfgezondheid",
+			"Model":                     "Model",
+			"Health":                    "Gezondheid",
+			"Reallocated sectors":       "Vervangen sectoren",
+			"Pending sectors":           "Onstabiele sectoren",
+			"Device":                    "Apparaat",
+			"Reads/s":                   "Leesacties/s",
+			"Read":                      "Gelezen",
+			"Writes/s":                  "Schrijfacties/s",
+			"Written":                   "Geschreven",
+			"Busy":                      "Bezet",
+			"Failed systemd units":      "Mislukte systemd-units",
+			"Systemd units":             "Systemd-units",
+			"Custom commands":           "Eigen commando's",
+			"Log files":                 "Logbestanden",
+			"missing":                   "ontbreekt",
+			"Unavailable":               "Niet beschikbaar",
+			"unavailable":               "niet beschikbaar",
+			"IP address":                "IP-adres",
+			"# of failures":             "# mislukt",
+			"Most tried user":           "Meest geprobeerde gebruiker",
+			"Location":                  "Locatie",
+			"Filesystem":                "Bestandssysteem",
+			"Size":                      "Grootte",
+			"Used":                      "Gebruikt",
+			"Available":                 "Beschikbaar",
+			"Percentage used":           "Percentage gebruikt",
+			"Inodes used":               "Inodes gebruikt",
+			"Mount point":               "Koppelpunt",
+			"User":                      "Gebruiker",
+			"From":                      "Vanaf",
+			"Logged in at":              "Aangemeld om",
+			"Banned since":              "Geblokkeerd sinds",
+			"Processes":                 "Processen",
+			"By CPU":                    "Op CPU",
+			"By memory":                 "Op geheugen",
+			"State":                     "Status",
+			"Hardware address":          "Hardware-adres",
+			"Addresses":                 "Adressen",
+			"Traffic since last report": "Verkeer sinds het vorige rapport",
+			"still logged in":           "nog aangemeld",
+			"none":                      "geen",
+			"last":                      "afgelopen",
+			"in the last":               "in de afgelopen",
+			"Total":                     "Totaal",
+			"Alerts":                    "Waarschuwingen",
+			"Listening ports":           "Luisterende poorten",
+			"Protocol":                  "Protocol",
+			"Address":                   "Adres",
+			"Port":                      "Poort",
+			"Process":                   "Proces",
+		},
+	},
+}
+
+func init() {
+	for _, t := range languages {
+		for _, unit := range []struct {
+			key   string
+			words [2]string
+		}{
+			{"%d days", t.days},
+			{"%d hours", t.hours},
+			{"%d minutes", t.minutes},
+			{"%d seconds", t.seconds},
+		} {
+			translations.Set(t.tag, unit.key, plural.Selectf(1, "%d",
+				"one", "%d "+unit.words[0],
+				"other", "%d "+unit.words[1]))
+		}
+		for key, msg := range t.messages {
+			translations.SetString(t.tag, key, msg)
+		}
+	}
+}
+
+// Returns a printer for the locale, like nl or en-GB, which translates the
+// fixed strings of the reports and formats numbers the way the locale does.
+// Languages without a translation get English strings, but still their own
+// number formatting. An empty locale is English.
+func NewPrinter(locale string) (*message.Printer, error) {
+	tag := language.English
+	if locale != "" {
+		var err error
+		if tag, err = language.Parse(locale); err != nil {
+			return nil, fmt.Errorf("Invalid locale `%s': %s", locale, err)
+		}
+	}
+
+	return message.NewPrinter(tag, message.Catalog(translations)), nil
+}
+
+// The printer for the default, English, reports.
+var englishPrinter, _ = NewPrinter("")
+
+// Returns the printer for the locale, or the English one when the locale is
+// invalid.
+func printerOrEnglish(locale string) *message.Printer {
+	if p, err := NewPrinter(locale); err == nil {
+		return p
+	}
+
+	return englishPrinter
+}
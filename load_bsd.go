@@ -0,0 +1,42 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package stats
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Gets the load averages of this box from the vm.loadavg sysctl. The BSDs
+// don't count the processes along with it, so Running and Total are zero.
+func GetLoadAverage() (LoadAverage, error) {
+	load := LoadAverage{}
+
+	raw, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil {
+		return load, fmt.Errorf("Unable to read vm.loadavg: %s", err)
+	}
+
+	// a struct loadavg, three fixed point numbers of 32 bits followed by the
+	// scale as a long, which is 32 or 64 bits (with padding before it).
+	var scale uint64
+	switch len(raw) {
+	case 16:
+		scale = uint64(binary.NativeEndian.Uint32(raw[12:]))
+	case 24:
+		scale = binary.NativeEndian.Uint64(raw[16:])
+	default:
+		return load, fmt.Errorf("Unexpected size of vm.loadavg: %d bytes", len(raw))
+	}
+	if scale == 0 {
+		return load, fmt.Errorf("Unexpected scale of vm.loadavg: 0")
+	}
+
+	load.Load1 = float64(binary.NativeEndian.Uint32(raw[0:])) / float64(scale)
+	load.Load5 = float64(binary.NativeEndian.Uint32(raw[4:])) / float64(scale)
+	load.Load15 = float64(binary.NativeEndian.Uint32(raw[8:])) / float64(scale)
+
+	return load, nil
+}
@@ -0,0 +1,26 @@
+package stats
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// The log level when none is configured.
+const DefaultLogLevel = "info"
+
+// Sets up the default logger to write to stderr, so stdout stays clean for
+// output which is meant to be piped, like the dry-run mail. Only messages of
+// the given level (debug, info, warn or error) and up are logged.
+func SetupLogging(level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return fmt.Errorf("Invalid log level `%s', expected debug, info, warn or error", level)
+	}
+
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: lvl})
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
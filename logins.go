@@ -0,0 +1,159 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+)
+
+// Where the current and the past logins are recorded.
+const (
+	utmpFile = "/var/run/utmp"
+	wtmpFile = "/var/log/wtmp"
+)
+
+// Amount of recent logins to report when none is configured.
+const defaultRecentLoginCount = 10
+
+// A record in utmp or wtmp, as defined by struct utmp in <utmp.h> on Linux.
+// The records are 384 bytes on both 32 and 64 bit systems.
+type utmpRecord struct {
+	Type    int16
+	_       int16
+	PID     int32
+	Line    [32]byte
+	ID      [4]byte
+	User    [32]byte
+	Host    [256]byte
+	Exit    [2]int16
+	Session int32
+	Sec     int32
+	Usec    int32
+	Addr    [4]int32
+	_       [20]byte
+}
+
+// The type of utmp records of a user logging in.
+const utmpUserProcess = 7
+
+// A user which logged in.
+type Login struct {
+	User string `json:"user"`
+	TTY  string `json:"tty"`
+	// Where the user logged in from, empty for local logins
+	Host string    `json:"host"`
+	Time time.Time `json:"time"`
+	// Whether the host is not one of the known login hosts, when those are
+	// configured
+	Unfamiliar bool `json:"unfamiliar"`
+}
+
+// Returns a simple string representation of this struct.
+func (l Login) String() string {
+	return fmt.Sprintf("%s on %s from %s at %s", l.User, l.TTY, l.Host, l.Time.Format("2006-01-02 15:04:05"))
+}
+
+// Gets the users which are logged in now, from utmp, like who does. Without a
+// utmp file, nobody is logged in.
+func GetLoggedInUsers() ([]Login, error) {
+	return readLogins(utmpFile, 0, time.Time{})
+}
+
+// Gets the n most recent logins since the given time from wtmp, the most
+// recent first, like last does. Without a wtmp file, there are no recent
+// logins.
+func GetRecentLogins(n int, since time.Time) ([]Login, error) {
+	return readLogins(wtmpFile, n, since)
+}
+
+// Reads the logins from the utmp formatted file, the most recent first. When
+// n is over zero, only the n most recent logins are returned. Logins before
+// since are skipped, unless it's the zero time.
+func readLogins(file string, n int, since time.Time) ([]Login, error) {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return []Login{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read `%s': %s", file, err)
+	}
+
+	recordSize := binary.Size(utmpRecord{})
+	logins := make([]Login, 0)
+	for end := len(content) - len(content)%recordSize; end > 0 && (n <= 0 || len(logins) < n); end -= recordSize {
+		var rec utmpRecord
+		if err = binary.Read(bytes.NewReader(content[end-recordSize:end]), binary.NativeEndian, &rec); err != nil {
+			return nil, fmt.Errorf("Unable to parse `%s': %s", file, err)
+		}
+		if rec.Type != utmpUserProcess {
+			continue
+		}
+
+		login := Login{
+			User: cString(rec.User[:]),
+			TTY:  cString(rec.Line[:]),
+			Host: cString(rec.Host[:]),
+			Time: time.Unix(int64(rec.Sec), int64(rec.Usec)*1000),
+		}
+		// the records are in chronological order, so everything before
+		// this one is older still.
+		if login.Time.Before(since) {
+			break
+		}
+		logins = append(logins, login)
+	}
+
+	return logins, nil
+}
+
+// Returns the NUL terminated string in b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+// Marks the logins from hosts which are not known as unfamiliar. A known host
+// is either a host name or IP address, or a network in CIDR notation. Local
+// logins are always familiar. Without any known hosts, nothing is marked.
+// Returns the amount of unfamiliar logins.
+func MarkUnfamiliarLogins(logins []Login, knownHosts []string) int {
+	if len(knownHosts) == 0 {
+		return 0
+	}
+
+	count := 0
+	for i := range logins {
+		if logins[i].Host != "" && !isKnownHost(logins[i].Host, knownHosts) {
+			logins[i].Unfamiliar = true
+			count++
+		}
+	}
+
+	return count
+}
+
+// Returns whether the host matches one of the known hosts.
+func isKnownHost(host string, knownHosts []string) bool {
+	ip := net.ParseIP(host)
+	for _, known := range knownHosts {
+		if known == host {
+			return true
+		}
+		// the same IPv6 address can be written in more than one way.
+		if knownIP := net.ParseIP(known); knownIP != nil && ip != nil && knownIP.Equal(ip) {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(known); err == nil && ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
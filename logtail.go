@@ -0,0 +1,114 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Defaults for the log tails.
+const (
+	// lines shown of a log file, when the entry doesn't say
+	defaultLogTailLines = 20
+	// bytes read from the end of a file at a time, looking for lines
+	logTailChunk = 4096
+)
+
+// The last lines of a log file in the report.
+type LogTail struct {
+	Label string `json:"label"`
+	Path  string `json:"path"`
+	// The amount of lines to show
+	Lines  int    `json:"lines"`
+	Output string `json:"output"`
+	// Whether the file doesn't exist
+	Missing bool `json:"missing"`
+	// Why the file couldn't be read, when it couldn't
+	Error string `json:"error"`
+}
+
+// Parses the log tails from the LogTails setting, where every entry is a
+// label, the path of the log file, and optionally the amount of lines, like
+// `Syslog=/var/log/syslog:50'. Entries without a path are skipped.
+func ParseLogTails(entries []string) []LogTail {
+	tails := make([]LogTail, 0, len(entries))
+	for _, entry := range entries {
+		label, file, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(file) == "" {
+			continue
+		}
+
+		lines := defaultLogTailLines
+		if i := strings.LastIndex(file, ":"); i >= 0 {
+			if n, err := strconv.Atoi(strings.TrimSpace(file[i+1:])); err == nil && n > 0 {
+				file, lines = file[:i], n
+			}
+		}
+		tails = append(tails, LogTail{Label: strings.TrimSpace(label), Path: strings.TrimSpace(file), Lines: lines})
+	}
+
+	return tails
+}
+
+// Reads the last lines of every log file. A file which doesn't exist is
+// marked missing, rather than failing the whole section.
+func ReadLogTails(tails []LogTail) {
+	for i := range tails {
+		out, err := tailFile(tails[i].Path, tails[i].Lines)
+		switch {
+		case os.IsNotExist(err):
+			tails[i].Missing = true
+		case err != nil:
+			tails[i].Error = logOpenError(tails[i].Path, err).Error()
+		default:
+			tails[i].Output = out
+		}
+	}
+}
+
+// Returns the last n lines of the file. The file is read backwards from the
+// end in chunks until there are enough lines, so a huge log costs no more
+// than its tail. A file shorter than n lines is returned as a whole.
+func tailFile(file string, n int) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	var tail []byte
+	offset := info.Size()
+	for offset > 0 {
+		size := int64(logTailChunk)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		chunk := make([]byte, size)
+		if _, err = f.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return "", fmt.Errorf("Unable to read `%s': %s", file, err)
+		}
+		tail = append(chunk, tail...)
+
+		// the newline ending the last line doesn't start another one.
+		if bytes.Count(bytes.TrimSuffix(tail, []byte("\n")), []byte("\n")) >= n {
+			break
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(tail), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Counts the messages delivered by this process, to keep Maildir file names
+// unique even when several are delivered within the same microsecond.
+var maildirDeliveries int64
+
+// Delivers the message into the Maildir at dir, creating its tmp, new and cur
+// directories when needed. Following the Maildir conventions, the message is
+// written in tmp first and then renamed into new, so a mail client never sees
+// a partially written message. The message has Unix line endings in the
+// Maildir, like any other local mail.
+func DeliverMaildir(dir string, message []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(path.Join(dir, sub), 0700); err != nil {
+			return fmt.Errorf("Unable to create Maildir `%s': %s", dir, err)
+		}
+	}
+
+	name := maildirName(time.Now())
+	tmpFile := path.Join(dir, "tmp", name)
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	if err := ioutil.WriteFile(tmpFile, message, 0600); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("Unable to write message to `%s': %s", tmpFile, err)
+	}
+
+	newFile := path.Join(dir, "new", name)
+	if err := os.Rename(tmpFile, newFile); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("Unable to move message to `%s': %s", newFile, err)
+	}
+
+	return nil
+}
+
+// Returns a unique file name for a message delivered at the given time, in
+// the `time.MusecPpid_Qdeliveries.host' format. Slashes and colons are not
+// allowed in the host name part, so they are escaped like the spec says.
+func maildirName(t time.Time) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+
+	count := atomic.AddInt64(&maildirDeliveries, 1)
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", t.Unix(), t.Nanosecond()/1000, os.Getpid(), count, host)
+}
@@ -0,0 +1,89 @@
+//go:build darwin
+
+package stats
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Time vm_stat gets to count the pages.
+const vmStatTimeout = 10 * time.Second
+
+// Gets the memory usage of this Mac, with the total from the hw.memsize
+// sysctl, the page counts from vm_stat and the swap from vm.swapusage. The
+// inactive and speculative pages are counted as available, like the free
+// ones, since macOS hands them out when it needs to.
+func GetMemoryInfo() (MemoryInfo, error) {
+	mem := MemoryInfo{}
+
+	total, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return mem, fmt.Errorf("Unable to read hw.memsize: %s", err)
+	}
+	mem.Total = total
+
+	ctx, cancel := context.WithTimeout(context.Background(), vmStatTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "vm_stat")
+	cmd.WaitDelay = killWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return mem, fmt.Errorf("Unable to run vm_stat: %s", err)
+	}
+
+	pages, pageSize := parseVmStat(string(out))
+	mem.Free = pages["Pages free"] * pageSize
+	mem.Available = (pages["Pages free"] + pages["Pages inactive"] + pages["Pages speculative"]) * pageSize
+	mem.Cached = pages["File-backed pages"] * pageSize
+
+	// a struct xsw_usage, which starts with the total, available and used
+	// swap as 64 bits numbers.
+	if raw, err := unix.SysctlRaw("vm.swapusage"); err == nil && len(raw) >= 24 {
+		mem.SwapTotal = binary.NativeEndian.Uint64(raw[0:])
+		mem.SwapFree = binary.NativeEndian.Uint64(raw[8:])
+	}
+
+	return mem, nil
+}
+
+// Parses the output of vm_stat, which counts pages like
+//
+//	Mach Virtual Memory Statistics: (page size of 16384 bytes)
+//	Pages free:                               12345.
+//
+// Returns the counts by their description, and the page size.
+func parseVmStat(out string) (map[string]uint64, uint64) {
+	pages := make(map[string]uint64)
+	// the page size of Intel Macs, when the header is missing
+	var pageSize uint64 = 4096
+
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(key, "Mach Virtual Memory Statistics") {
+			var size uint64
+			if _, err := fmt.Sscanf(strings.TrimSpace(val), "(page size of %d bytes)", &size); err == nil && size > 0 {
+				pageSize = size
+			}
+			continue
+		}
+
+		n, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(val), "."), 10, 64)
+		if err != nil {
+			continue
+		}
+		pages[strings.TrimSpace(key)] = n
+	}
+
+	return pages, pageSize
+}
@@ -0,0 +1,40 @@
+//go:build freebsd
+
+package stats
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Gets the memory usage of this box from the vm.stats sysctls, which count
+// pages. The inactive pages are counted as available, like the free ones.
+// The swap isn't reported, FreeBSD only has it per device.
+func GetMemoryInfo() (MemoryInfo, error) {
+	mem := MemoryInfo{}
+
+	total, err := unix.SysctlUint64("hw.physmem")
+	if err != nil {
+		return mem, fmt.Errorf("Unable to read hw.physmem: %s", err)
+	}
+	mem.Total = total
+
+	pageSize, err := unix.SysctlUint32("hw.pagesize")
+	if err != nil {
+		return mem, fmt.Errorf("Unable to read hw.pagesize: %s", err)
+	}
+
+	counts := make(map[string]uint64)
+	for _, name := range []string{"v_free_count", "v_inactive_count"} {
+		n, err := unix.SysctlUint32("vm.stats.vm." + name)
+		if err != nil {
+			return mem, fmt.Errorf("Unable to read vm.stats.vm.%s: %s", name, err)
+		}
+		counts[name] = uint64(n) * uint64(pageSize)
+	}
+	mem.Free = counts["v_free_count"]
+	mem.Available = counts["v_free_count"] + counts["v_inactive_count"]
+
+	return mem, nil
+}
@@ -0,0 +1,13 @@
+//go:build netbsd || openbsd || dragonfly
+
+package stats
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The memory usage is only implemented for Linux, macOS and FreeBSD.
+func GetMemoryInfo() (MemoryInfo, error) {
+	return MemoryInfo{}, fmt.Errorf("Unable to read the memory usage on %s", runtime.GOOS)
+}
@@ -0,0 +1,140 @@
+package stats
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+)
+
+// Descriptions of the metrics exported on /metrics.
+var (
+	uptimeDesc = prometheus.NewDesc("stats_uptime_seconds",
+		"Time since the box booted.", nil, nil)
+	loadDesc = prometheus.NewDesc("stats_load_average",
+		"Load average over the period.", []string{"period"}, nil)
+	memoryUsedDesc = prometheus.NewDesc("stats_memory_used_bytes",
+		"Memory in use, i.e. not available for new applications.", nil, nil)
+	memoryTotalDesc = prometheus.NewDesc("stats_memory_total_bytes",
+		"Total amount of memory.", nil, nil)
+	swapUsedDesc = prometheus.NewDesc("stats_swap_used_bytes",
+		"Swap space in use.", nil, nil)
+	swapTotalDesc = prometheus.NewDesc("stats_swap_total_bytes",
+		"Total amount of swap space.", nil, nil)
+	diskUsedDesc = prometheus.NewDesc("stats_disk_used_percent",
+		"Disk usage of a file system, as reported by df.", []string{"mountpoint", "filesystem"}, nil)
+	inodesUsedDesc = prometheus.NewDesc("stats_inodes_used_percent",
+		"Inode usage of a file system, as reported by df -i.", []string{"mountpoint", "filesystem"}, nil)
+	failedLoginsDesc = prometheus.NewDesc("stats_failed_logins",
+		"Failed logins in the analyzed auth log.", nil, nil)
+	failedLoginIPsDesc = prometheus.NewDesc("stats_failed_login_addresses",
+		"IP addresses with failed logins in the analyzed auth log.", nil, nil)
+	netReceiveDesc = prometheus.NewDesc("stats_network_receive_bytes_total",
+		"Bytes received by a network interface.", []string{"interface"}, nil)
+	netTransmitDesc = prometheus.NewDesc("stats_network_transmit_bytes_total",
+		"Bytes sent by a network interface.", []string{"interface"}, nil)
+	temperatureDesc = prometheus.NewDesc("stats_temperature_celsius",
+		"Temperature of a thermal zone.", []string{"zone", "type"}, nil)
+	failedUnitsDesc = prometheus.NewDesc("stats_systemd_failed_units",
+		"Systemd units in the failed state.", nil, nil)
+	updatesDesc = prometheus.NewDesc("stats_package_updates",
+		"Package updates available.", nil, nil)
+	securityUpdatesDesc = prometheus.NewDesc("stats_package_security_updates",
+		"Package updates available which are security updates.", nil, nil)
+	collectorFailedDesc = prometheus.NewDesc("stats_collector_failed",
+		"Whether a collector failed (1) during the last collection.", []string{"collector"}, nil)
+)
+
+// Exports the report of a ReportServer as Prometheus metrics. The report is
+// collected when scraped, using the cache of the server.
+type reportCollector struct {
+	rs *ReportServer
+}
+
+// Sends the descriptions of all the metrics which may be collected.
+func (c reportCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		uptimeDesc, loadDesc, memoryUsedDesc, memoryTotalDesc, swapUsedDesc, swapTotalDesc,
+		diskUsedDesc, inodesUsedDesc, failedLoginsDesc, failedLoginIPsDesc,
+		netReceiveDesc, netTransmitDesc, temperatureDesc, failedUnitsDesc,
+		updatesDesc, securityUpdatesDesc, collectorFailedDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collects the report, and sends its metrics. Sections which could not be
+// collected are left out, stats_collector_failed tells which.
+func (c reportCollector) Collect(ch chan<- prometheus.Metric) {
+	report, err := c.rs.Report(context.Background())
+	if err != nil {
+		slog.Error("Unable to collect the report for the metrics", "error", err)
+		return
+	}
+
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	if _, failed := report.Errors["uptime"]; !failed {
+		gauge(uptimeDesc, report.UptimeSeconds)
+	}
+	if load := report.Load; load != nil {
+		gauge(loadDesc, load.Load1, "1m")
+		gauge(loadDesc, load.Load5, "5m")
+		gauge(loadDesc, load.Load15, "15m")
+	}
+	if mem := report.Memory; mem != nil {
+		gauge(memoryUsedDesc, float64(mem.Used()))
+		gauge(memoryTotalDesc, float64(mem.Total))
+		gauge(swapUsedDesc, float64(mem.SwapUsed()))
+		gauge(swapTotalDesc, float64(mem.SwapTotal))
+	}
+
+	// a mount point can be listed twice (stacked mounts), which would be a
+	// duplicate metric and fail the whole scrape.
+	seen := make(map[string]bool)
+	for _, fs := range report.FreeSpace {
+		if seen[fs.MountPoint] {
+			continue
+		}
+		seen[fs.MountPoint] = true
+
+		if fs.UsePercent >= 0 {
+			gauge(diskUsedDesc, float64(fs.UsePercent), fs.MountPoint, fs.FileSystem)
+		}
+		if fs.IUsePercent >= 0 {
+			gauge(inodesUsedDesc, float64(fs.IUsePercent), fs.MountPoint, fs.FileSystem)
+		}
+	}
+
+	if _, failed := report.Errors["authlog"]; !failed {
+		total := 0
+		for _, f := range report.Failures {
+			total += f.Failures
+		}
+		gauge(failedLoginsDesc, float64(total))
+		gauge(failedLoginIPsDesc, float64(len(report.Failures)))
+	}
+
+	for _, iface := range report.Interfaces {
+		ch <- prometheus.MustNewConstMetric(netReceiveDesc, prometheus.CounterValue, float64(iface.Counters.RxBytes), iface.Name)
+		ch <- prometheus.MustNewConstMetric(netTransmitDesc, prometheus.CounterValue, float64(iface.Counters.TxBytes), iface.Name)
+	}
+
+	for _, zone := range report.Temperatures {
+		gauge(temperatureDesc, zone.Celsius, zone.Zone, zone.Type)
+	}
+
+	if _, failed := report.Errors["systemd"]; !failed {
+		gauge(failedUnitsDesc, float64(len(report.FailedUnits)))
+	}
+
+	if updates := report.Updates; updates != nil {
+		gauge(updatesDesc, float64(updates.Total))
+		gauge(securityUpdatesDesc, float64(updates.Security))
+	}
+
+	for name := range report.Errors {
+		gauge(collectorFailedDesc, 1, name)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !race
+
+package stats
+
+// Whether the race detector is on, see race_test.go.
+const raceEnabled = false
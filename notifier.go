@@ -0,0 +1,256 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+// The webhook payload formats.
+const (
+	WEBHOOK_FORMAT_JSON  = "json"
+	WEBHOOK_FORMAT_SLACK = "slack"
+)
+
+// Time to wait for a webhook to respond, when none is configured.
+const defaultWebhookTimeout = 10 * time.Second
+
+// Sends a report somewhere, like a mailbox or a chat channel.
+type Notifier interface {
+	Send(report ReportData) error
+}
+
+// Notifies by mail. The mail settings are complete, except for the subject,
+// which is a template, and the bodies, which are rendered from the report.
+type MailNotifier struct {
+	Settings MailSettings
+	// The HTML template, or empty for the default one
+	TemplatePath string
+	// How the mail is delivered, DELIVERY_SMTP, DELIVERY_MAILDIR or
+	// DELIVERY_SENDMAIL
+	Delivery string
+	// The Maildir to deliver to, when delivering to a Maildir
+	MaildirPath string
+	// The sendmail binary, when delivering through the local MTA
+	SendmailPath string
+	// Which report to attach to the mail, ATTACH_NONE, ATTACH_HTML or
+	// ATTACH_JSON
+	Attach string
+}
+
+// Returns the mail settings with the subject and bodies rendered for the
+// given report.
+func (n *MailNotifier) Prepare(report *ReportData) (*MailSettings, error) {
+	ms := n.Settings
+
+	var err error
+	if ms.MailSubject, err = PrepareSubject(ms.MailSubject, report); err != nil {
+		return nil, err
+	}
+	// make the bad news stand out in the inbox.
+	if severity := report.MaxSeverity(); severity >= SEVERITY_WARNING {
+		ms.MailSubject = fmt.Sprintf("[%s] %s", strings.ToUpper(severity.String()), ms.MailSubject)
+	}
+	if ms.Body, err = PrepareMail(report, n.TemplatePath); err != nil {
+		return nil, err
+	}
+	if ms.TextBody, err = PrepareText(report); err != nil {
+		return nil, err
+	}
+
+	// attached reports are named after their date, so an archive of them
+	// sorts nicely.
+	name := "report-" + report.Time.Format("2006-01-02")
+	switch n.Attach {
+	case ATTACH_HTML:
+		ms.Attachments = []Attachment{{name + ".html", "text/html; charset=UTF-8", []byte(ms.Body)}}
+	case ATTACH_JSON:
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to encode the report: %s", err)
+		}
+		ms.Attachments = []Attachment{{name + ".json", "application/json", content}}
+	}
+
+	return &ms, nil
+}
+
+// Creates the mail notifier from the configuration. The configuration is not
+// validated here, see ValidateConfig for that.
+func MailNotifierFromConfig(cfg Config) *MailNotifier {
+	return &MailNotifier{
+		Settings:     cfg.Mail,
+		TemplatePath: cfg.TemplatePath,
+		Delivery:     cfg.DeliveryMethod,
+		MaildirPath:  cfg.MaildirPath,
+		SendmailPath: cfg.SendmailPath,
+		Attach:       strings.ToLower(cfg.AttachReport),
+	}
+}
+
+// Renders the report into a mail and sends it, drops it in the Maildir, or
+// hands it to sendmail.
+func (n *MailNotifier) Send(report ReportData) error {
+	ms, err := n.Prepare(&report)
+	if err != nil {
+		return err
+	}
+
+	switch n.Delivery {
+	case DELIVERY_MAILDIR:
+		return DeliverMaildir(n.MaildirPath, BuildMessage(ms))
+	case DELIVERY_SENDMAIL:
+		return DeliverSendmail(n.SendmailPath, ms, BuildMessage(ms))
+	}
+
+	if err = SendMail(ms); err != nil {
+		return fmt.Errorf("Error while sending mail: %s", err)
+	}
+
+	return nil
+}
+
+// Checks whether mail can be delivered, without delivering any: the mail host
+// accepts the connection and the credentials, the Maildir can be created, or
+// the sendmail binary exists.
+func (n *MailNotifier) Verify() error {
+	switch n.Delivery {
+	case DELIVERY_MAILDIR:
+		if err := os.MkdirAll(path.Join(n.MaildirPath, "tmp"), 0700); err != nil {
+			return fmt.Errorf("Unable to create Maildir `%s': %s", n.MaildirPath, err)
+		}
+		return nil
+	case DELIVERY_SENDMAIL:
+		if _, err := exec.LookPath(n.SendmailPath); err != nil {
+			return fmt.Errorf("No sendmail at `%s': %s", n.SendmailPath, err)
+		}
+		return nil
+	}
+
+	return VerifySMTP(&n.Settings)
+}
+
+// Notifies by POSTing the report to a webhook. The payload is either the
+// whole report as JSON, or a Slack message summarizing it.
+type WebhookNotifier struct {
+	URL     string
+	Format  string
+	Timeout time.Duration
+}
+
+// Creates the payload to POST for the given report.
+func (n *WebhookNotifier) Payload(report *ReportData) ([]byte, error) {
+	switch n.Format {
+	case WEBHOOK_FORMAT_JSON, "":
+		return json.Marshal(report)
+	case WEBHOOK_FORMAT_SLACK:
+		return json.Marshal(slackMessage(report))
+	}
+
+	return nil, fmt.Errorf("Unknown webhook format `%s'", n.Format)
+}
+
+// POSTs the report to the webhook. Any reply other than a 2xx is an error.
+func (n *WebhookNotifier) Send(report ReportData) error {
+	payload, err := n.Payload(&report)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: n.Timeout}
+	resp, err := client.Post(n.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("Unable to call webhook: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook replied with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Creates the webhook notifier from the configuration, or returns nil when no
+// WebhookURL is configured.
+func WebhookNotifierFromConfig(cfg Config) (*WebhookNotifier, error) {
+	if cfg.WebhookURL == "" {
+		return nil, nil
+	}
+
+	n := &WebhookNotifier{
+		URL:     cfg.WebhookURL,
+		Format:  cfg.WebhookFormat,
+		Timeout: cfg.WebhookTimeout,
+	}
+	if _, err := n.Payload(&ReportData{}); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// A message in the Slack Block Kit format, which incoming webhooks accept.
+// The text is shown in notifications, the blocks in the channel.
+type slackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Returns the emoji an alert of the severity is shown with in Slack.
+func slackEmoji(severity Severity) string {
+	switch severity {
+	case SEVERITY_CRITICAL:
+		return ":rotating_light:"
+	case SEVERITY_WARNING:
+		return ":warning:"
+	}
+
+	return ":information_source:"
+}
+
+// Summarizes the report in a Slack message: a header, the alerts, one per
+// line, and a context line with the uptime and load.
+func slackMessage(report *ReportData) slackPayload {
+	title := "Server report"
+	if report.System.Hostname != "" {
+		title += " - " + report.System.Hostname
+	}
+
+	msg := slackPayload{Text: title}
+	msg.Blocks = append(msg.Blocks, slackBlock{Type: "header", Text: &slackText{"plain_text", title}})
+
+	summary := ""
+	for _, alert := range report.Alerts {
+		summary += fmt.Sprintf("%s *%s*: %s\n", slackEmoji(alert.Severity), alert.Category, alert.Message)
+	}
+	if summary == "" {
+		summary = ":white_check_mark: Nothing to report"
+	}
+	msg.Blocks = append(msg.Blocks, slackBlock{Type: "section", Text: &slackText{"mrkdwn", summary}})
+
+	context := "Up " + report.Uptime
+	if report.Load != nil {
+		context += fmt.Sprintf(", load %.2f %.2f %.2f", report.Load.Load1, report.Load.Load5, report.Load.Load15)
+	}
+	msg.Blocks = append(msg.Blocks, slackBlock{Type: "context", Elements: []slackText{{"mrkdwn", context}}})
+
+	return msg
+}
@@ -0,0 +1,150 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Values for the MailAuthMethod setting.
+const (
+	MAIL_AUTH_PLAIN   string = "plain"
+	MAIL_AUTH_XOAUTH2 string = "xoauth2"
+)
+
+// The token endpoint of Google, which is what XOAUTH2 is mostly used for.
+const defaultOAuthTokenURL = "https://oauth2.googleapis.com/token"
+
+// Time to wait for the token endpoint to respond.
+const oauthTimeout = 30 * time.Second
+
+// Settings for XOAUTH2 authentication. Either a (short lived) access token is
+// given, or a refresh token with the client credentials to obtain a fresh
+// access token with.
+type OAuthSettings struct {
+	AccessToken  string `setting:"MailOAuthToken"`
+	RefreshToken string `setting:"MailOAuthRefreshToken"`
+	ClientID     string `setting:"MailOAuthClientId"`
+	ClientSecret string `setting:"MailOAuthClientSecret"`
+	TokenURL     string `setting:"MailOAuthTokenURL"`
+}
+
+// Encodes this struct as JSON, with the tokens and the client secret redacted.
+func (o OAuthSettings) MarshalJSON() ([]byte, error) {
+	// the alias has no methods, or this would recurse.
+	type oauthSettings OAuthSettings
+	plain := oauthSettings(o)
+	plain.AccessToken = redact(plain.AccessToken)
+	plain.RefreshToken = redact(plain.RefreshToken)
+	plain.ClientSecret = redact(plain.ClientSecret)
+
+	return json.Marshal(plain)
+}
+
+// Returns an access token: the configured one, or a fresh one obtained with
+// the refresh token when there is one.
+func (o *OAuthSettings) Token() (string, error) {
+	if o.RefreshToken == "" {
+		if o.AccessToken == "" {
+			return "", errors.New("No OAuth access token or refresh token configured")
+		}
+		return o.AccessToken, nil
+	}
+
+	return RefreshAccessToken(o.TokenURL, o.ClientID, o.ClientSecret, o.RefreshToken)
+}
+
+// Obtains a new access token from the token endpoint at tokenURL, using the
+// refresh token grant of RFC 6749.
+func RefreshAccessToken(tokenURL, clientID, clientSecret, refreshToken string) (string, error) {
+	if tokenURL == "" {
+		tokenURL = defaultOAuthTokenURL
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	client := &http.Client{Timeout: oauthTimeout}
+	resp, err := client.PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("Unable to refresh OAuth access token: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", fmt.Errorf("Unable to parse OAuth token reply (%s): %s", resp.Status, err)
+	}
+	if reply.Error != "" {
+		return "", fmt.Errorf("Unable to refresh OAuth access token: %s %s", reply.Error, reply.ErrorDescription)
+	}
+	if reply.AccessToken == "" {
+		return "", fmt.Errorf("No OAuth access token in reply (%s)", resp.Status)
+	}
+
+	return reply.AccessToken, nil
+}
+
+// Implements the XOAUTH2 SASL mechanism, as used by Gmail and Outlook.
+type xoauth2Auth struct {
+	username string
+	token    string
+}
+
+// Returns an smtp.Auth authenticating the username with an OAuth 2.0 access
+// token. Like smtp.PlainAuth, it refuses to send the token over an
+// unencrypted connection.
+func XOAuth2Auth(username, token string) smtp.Auth {
+	return &xoauth2Auth{username, token}
+}
+
+// Starts the authentication with the initial response, which is the user
+// and the bearer token separated by ^A. The smtp package does the base64.
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, errors.New("Refusing to send the OAuth token over an unencrypted connection")
+	}
+
+	resp := "user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"
+	return "XOAUTH2", []byte(resp), nil
+}
+
+// Handles the challenge of the server. On failure, the server sends a JSON
+// error as a challenge, which must be answered with an empty response before
+// it replies with the actual error.
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+
+	return nil, nil
+}
+
+// Returns the smtp.Auth for the configured MailAuthMethod.
+func (ms *MailSettings) Auth() (smtp.Auth, error) {
+	switch strings.ToLower(ms.AuthMethod) {
+	case MAIL_AUTH_PLAIN, "":
+		return smtp.PlainAuth("", ms.Username, ms.Password, ms.AuthHost()), nil
+	case MAIL_AUTH_XOAUTH2:
+		token, err := ms.OAuth.Token()
+		if err != nil {
+			return nil, err
+		}
+		return XOAuth2Auth(ms.Username, token), nil
+	}
+
+	return nil, fmt.Errorf("Unknown mail authentication method `%s', expected %s or %s",
+		ms.AuthMethod, MAIL_AUTH_PLAIN, MAIL_AUTH_XOAUTH2)
+}
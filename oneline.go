@@ -0,0 +1,84 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The fields rendered by the oneline format when none are configured.
+var DefaultOneLineFields = []string{"uptime", "load", "disk", "mem", "fails"}
+
+// Formats a duration in its most significant unit only, like `12d', `5h' or
+// `3m'. Meant for places where space is scarce, like a status bar.
+func FormatDurationShort(dur time.Duration) string {
+	switch {
+	case dur >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(dur.Hours()/24))
+	case dur >= time.Hour:
+		return fmt.Sprintf("%dh", int(dur.Hours()))
+	case dur >= time.Minute:
+		return fmt.Sprintf("%dm", int(dur.Minutes()))
+	}
+
+	return fmt.Sprintf("%ds", int(dur.Seconds()))
+}
+
+// Creates a terse, single line summary of this box, suitable for status bars
+// like tmux or waybar, e.g. `up 12d | load 0.8 | / 74% | mem 41% | 3 fails'.
+// Only the collectors required for the OneLineFields are run. Fields which
+// cannot be collected are left out, unknown fields result in an error.
+func FormatOneLine(ctx context.Context, cfg Config) (string, error) {
+	parts := make([]string, 0, len(cfg.OneLineFields))
+
+	for _, field := range cfg.OneLineFields {
+		switch field {
+		case "uptime":
+			if ut, err := GetUptime(); err == nil {
+				parts = append(parts, "up "+FormatDurationShort(ut))
+			}
+		case "load":
+			if load, err := GetLoadAverage(); err == nil {
+				parts = append(parts, fmt.Sprintf("load %.1f", load.Load1))
+			}
+		case "ip":
+			if ip, err := GetExtIPAddressFromConfig(ctx, cfg); err == nil {
+				parts = append(parts, ip)
+			}
+		case "disk":
+			fsEntries, err := GetFreeDiskSpaceFromConfig(ctx, cfg)
+			if err != nil {
+				continue
+			}
+			for _, fs := range fsEntries {
+				if fs.MountPoint == "/" {
+					parts = append(parts, "/ "+fs.UsePercentage)
+				}
+			}
+		case "mem":
+			if mem, err := GetMemoryInfo(); err == nil {
+				parts = append(parts, fmt.Sprintf("mem %.0f%%", mem.UsedPercentage()))
+			}
+		case "fails":
+			if failures, err := AnalyzeAuthLog(ctx, cfg.AuthLog); err == nil {
+				total := 0
+				for _, f := range failures {
+					total += f.Failures
+				}
+				parts = append(parts, fmt.Sprintf("%d fails", total))
+			}
+		case "bans":
+			if cfg.Fail2banLog == "" {
+				continue
+			}
+			if f2b, err := AnalyzeFail2banLog(cfg.Fail2banLog); err == nil {
+				parts = append(parts, fmt.Sprintf("%d bans", len(f2b.Active)))
+			}
+		default:
+			return "", fmt.Errorf("Unknown oneline field `%s'", field)
+		}
+	}
+
+	return strings.Join(parts, " | "), nil
+}
@@ -0,0 +1,82 @@
+//go:build !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Gets the load averages of this box by reading /proc/loadavg, which looks
+// like `0.20 0.18 0.12 1/80 11206'. Returns an error when the file is absent,
+// like on non-Linux systems.
+func GetLoadAverage() (LoadAverage, error) {
+	load := LoadAverage{}
+
+	lfile, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load, fmt.Errorf("Unable to read /proc/loadavg: %s", err)
+	}
+
+	fld := strings.Fields(string(lfile))
+	if len(fld) < 4 {
+		return load, fmt.Errorf("Unexpected format of /proc/loadavg: `%s'", strings.TrimSpace(string(lfile)))
+	}
+
+	_, err = fmt.Sscanf(strings.Join(fld[:4], " "), "%f %f %f %d/%d",
+		&load.Load1, &load.Load5, &load.Load15, &load.Running, &load.Total)
+	if err != nil {
+		return load, fmt.Errorf("Unable to parse /proc/loadavg: %s", err)
+	}
+
+	return load, nil
+}
+
+// Gets the memory usage of this box by parsing /proc/meminfo. Lines which
+// are not in the expected `Key:   value kB' format are skipped.
+func GetMemoryInfo() (MemoryInfo, error) {
+	mem := MemoryInfo{}
+
+	mfile, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return mem, fmt.Errorf("Unable to read /proc/meminfo: %s", err)
+	}
+
+	// map the keys we're interested in to the fields to set.
+	fields := map[string]*uint64{
+		"MemTotal":     &mem.Total,
+		"MemFree":      &mem.Free,
+		"MemAvailable": &mem.Available,
+		"Buffers":      &mem.Buffers,
+		"Cached":       &mem.Cached,
+		"SwapTotal":    &mem.SwapTotal,
+		"SwapFree":     &mem.SwapFree,
+	}
+
+	for _, line := range strings.Split(string(mfile), "\n") {
+		fld := strings.Fields(line)
+		if len(fld) != 3 || fld[2] != "kB" || !strings.HasSuffix(fld[0], ":") {
+			continue
+		}
+
+		target, ok := fields[strings.TrimSuffix(fld[0], ":")]
+		if !ok {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fld[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		*target = kb * 1024
+	}
+
+	// the details are nice to have, the totals are in meminfo already.
+	if swaps, err := GetSwaps(); err == nil {
+		mem.Swaps = swaps
+	}
+
+	return mem, nil
+}
@@ -0,0 +1,231 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Amount of top processes to report when none is configured.
+const defaultTopProcessCount = 5
+
+// Clock ticks per second, in which /proc/<pid>/stat reports CPU times. This is
+// 100 on practically every Linux system.
+const clockTicks = 100
+
+// A running process.
+type Process struct {
+	PID     int    `json:"pid"`
+	Command string `json:"command"`
+	// CPU usage over the lifetime of the process, like ps reports it
+	CPUPercent float64 `json:"cpu_percent"`
+	// Resident memory
+	RSSBytes uint64 `json:"rss_bytes"`
+	User     string `json:"user"`
+	// When the process started, zero when that's unknown, like without /proc
+	Started time.Time `json:"started"`
+}
+
+// Returns a simple string representation of this struct.
+func (p Process) String() string {
+	return fmt.Sprintf("%d %s (%s): %.1f%% CPU, %s", p.PID, p.Command, p.User, p.CPUPercent, formatBytes(p.RSSBytes))
+}
+
+// Gets the top n processes sorted by CPU usage, and the top n sorted by
+// resident memory. The processes are read from /proc, or from the output of
+// ps when /proc is not available.
+func GetTopProcesses(ctx context.Context, n int) (byCPU []Process, byMemory []Process, err error) {
+	procs, err := listProcesses(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byCPU, byMemory = sortTopProcesses(procs, n)
+	return byCPU, byMemory, nil
+}
+
+// Lists all processes, from /proc, or from the output of ps when /proc is
+// not available.
+func listProcesses(ctx context.Context) ([]Process, error) {
+	procs, err := readProcProcesses()
+	if err != nil {
+		return readPsProcesses(ctx)
+	}
+
+	return procs, nil
+}
+
+// Returns the top n of the processes sorted by CPU usage, and the top n
+// sorted by resident memory. The processes are sorted in place.
+func sortTopProcesses(procs []Process, n int) (byCPU []Process, byMemory []Process) {
+	if n > len(procs) {
+		n = len(procs)
+	}
+
+	sort.Slice(procs, func(i, j int) bool { return procs[i].CPUPercent > procs[j].CPUPercent })
+	byCPU = append([]Process(nil), procs[:n]...)
+
+	sort.Slice(procs, func(i, j int) bool { return procs[i].RSSBytes > procs[j].RSSBytes })
+	byMemory = append([]Process(nil), procs[:n]...)
+
+	return byCPU, byMemory
+}
+
+// Reads all processes from /proc. Processes which disappear while scanning
+// are skipped silently.
+func readProcProcesses() ([]Process, error) {
+	uptime, err := GetUptime()
+	if err != nil {
+		return nil, err
+	}
+	boot, err := readBootTime()
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil || len(dirs) == 0 {
+		return nil, fmt.Errorf("Unable to list processes in /proc")
+	}
+
+	// cache the user names, most processes belong to a few users.
+	users := make(map[string]string)
+
+	procs := make([]Process, 0, len(dirs))
+	for _, dir := range dirs {
+		proc, ok := readProcProcess(dir, uptime.Seconds(), boot, users)
+		if ok {
+			procs = append(procs, proc)
+		}
+	}
+
+	return procs, nil
+}
+
+// Reads the time the box booted from /proc/stat. Unlike the uptime it's a
+// whole second which doesn't drift, so the start times of processes computed
+// from it are the same in every run.
+func readBootTime() (time.Time, error) {
+	content, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to read /proc/stat")
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fld := strings.Fields(line)
+		if len(fld) == 2 && fld[0] == "btime" {
+			secs, err := strconv.ParseInt(fld[1], 10, 64)
+			if err != nil {
+				break
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("No boot time in /proc/stat")
+}
+
+// Reads a single process from its /proc/<pid> directory. Returns false when
+// the process is gone, or its files can't be parsed.
+func readProcProcess(dir string, uptime float64, boot time.Time, users map[string]string) (Process, bool) {
+	proc := Process{}
+
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return proc, false
+	}
+
+	// the command is between parentheses, and may contain anything itself,
+	// including spaces and parentheses. So look for the last one.
+	content := string(stat)
+	open, close := strings.IndexByte(content, '('), strings.LastIndexByte(content, ')')
+	if open < 0 || close < open {
+		return proc, false
+	}
+	proc.PID, _ = strconv.Atoi(strings.TrimSpace(content[:open]))
+	proc.Command = content[open+1 : close]
+
+	// fields after the command, starting with the state (field 3).
+	fld := strings.Fields(content[close+1:])
+	if len(fld) < 20 {
+		return proc, false
+	}
+	utime, _ := strconv.ParseFloat(fld[11], 64)
+	stime, _ := strconv.ParseFloat(fld[12], 64)
+	starttime, _ := strconv.ParseFloat(fld[19], 64)
+	if elapsed := uptime - starttime/clockTicks; elapsed > 0 {
+		proc.CPUPercent = (utime + stime) / clockTicks / elapsed * 100
+	}
+	proc.Started = boot.Add(time.Duration(starttime) * time.Second / clockTicks)
+
+	status, err := ioutil.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return proc, false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		fld := strings.Fields(line)
+		if len(fld) < 2 {
+			continue
+		}
+		switch fld[0] {
+		case "VmRSS:":
+			kb, _ := strconv.ParseUint(fld[1], 10, 64)
+			proc.RSSBytes = kb * 1024
+		case "Uid:":
+			proc.User = lookupUsername(fld[1], users)
+		}
+	}
+
+	return proc, true
+}
+
+// Returns the name of the user with the given uid, or the uid itself when the
+// user can't be found.
+func lookupUsername(uid string, users map[string]string) string {
+	if name, ok := users[uid]; ok {
+		return name
+	}
+
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	users[uid] = name
+
+	return name
+}
+
+// Reads all processes from the output of ps, for systems without /proc.
+func readPsProcesses(ctx context.Context) ([]Process, error) {
+	cmd := exec.CommandContext(ctx, "ps", "-axo", "pid=,user=,pcpu=,rss=,comm=")
+	cmd.WaitDelay = killWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list processes: no /proc, and ps failed: %s", err)
+	}
+
+	procs := make([]Process, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		fld := strings.Fields(line)
+		if len(fld) < 5 {
+			continue
+		}
+
+		proc := Process{User: fld[1], Command: strings.Join(fld[4:], " ")}
+		proc.PID, _ = strconv.Atoi(fld[0])
+		proc.CPUPercent, _ = strconv.ParseFloat(fld[2], 64)
+		kb, _ := strconv.ParseUint(fld[3], 10, 64)
+		proc.RSSBytes = kb * 1024
+
+		procs = append(procs, proc)
+	}
+
+	return procs, nil
+}
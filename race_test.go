@@ -0,0 +1,7 @@
+//go:build race
+
+package stats
+
+// Whether the race detector is on, which makes the heap grow far more than
+// the code under test does.
+const raceEnabled = true
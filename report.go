@@ -0,0 +1,820 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// All the data collected for a single report. This is what the mail template
+// is rendered with, both the default and a custom one (see TemplatePath).
+// Templates can use every field and method, for example:
+//
+//	{{ .Uptime }}
+//	{{ range .Failures }}{{ .IPAddress }} {{ .TopUsername }}{{ end }}
+//	{{ if .HasAlert }}...{{ end }}
+//
+// Sections which could not be collected are nil or empty, and the reason is
+// in Errors, by the name of the collector:
+//
+//	{{ with index .Errors "df" }}Disk usage unavailable: {{ . }}{{ end }}
+//
+// Sections turned off with the DisabledSections setting are empty too, see
+// Enabled.
+//
+// The HTML template is an html/template, so values like usernames and
+// hostnames, which attackers choose, are escaped wherever they end up.
+//
+// Next to the standard template functions there are:
+//
+//	bytes      formats a byte count, like {{ bytes .Memory.Total }}
+//	diskAlert  whether an FsEntry is over the disk or inode usage threshold
+//	T          translates a fixed string to the Locale, like {{ T "Uptime" }}
+//	num        formats a number the way the Locale does
+//	duration   formats a duration in words, like {{ duration .Window }}
+//
+// The report is also available as JSON, see MarshalJSON, with the fields by
+// their json tags, in snake case. Durations are in nanoseconds, times in RFC
+// 3339 and severities by their name.
+type ReportData struct {
+	// When the report was collected
+	Time       time.Time       `json:"time"`
+	System     SystemInfo      `json:"system"`
+	Uptime     string          `json:"uptime"`
+	Load       *LoadAverage    `json:"load"`
+	Memory     *MemoryInfo     `json:"memory"`
+	ExtIp      string          `json:"ext_ip"`
+	Interfaces []InterfaceInfo `json:"interfaces"`
+	Failures   []AuthFailure   `json:"failures"`
+	Fail2ban   *Fail2banReport `json:"fail2ban"`
+	FreeSpace  []FsEntry       `json:"free_space"`
+	DiskIO     []DiskIO        `json:"disk_io"`
+	TopCPU     []Process       `json:"top_cpu"`
+	TopMemory  []Process       `json:"top_memory"`
+
+	// the uptime in seconds, for machines rather than humans
+	UptimeSeconds float64 `json:"uptime_seconds"`
+
+	// the locale the report is written in, empty for the default English
+	Locale string `json:"locale"`
+
+	// when the box booted, and whether that was less than RebootThreshold
+	// ago. An unexpected reboot is worth an alert.
+	BootTime         time.Time     `json:"boot_time"`
+	RecentlyRebooted bool          `json:"recently_rebooted"`
+	RebootThreshold  time.Duration `json:"reboot_threshold"`
+
+	// when the previous report was collected, whether it was sent or had
+	// nothing worth sending, zero before the first one, and whether that was
+	// more than GapThreshold ago. A gap means runs went missing, like when
+	// cron failed or the box was down.
+	PreviousReport time.Time     `json:"previous_report"`
+	HasReportGap   bool          `json:"has_report_gap"`
+	GapThreshold   time.Duration `json:"gap_threshold"`
+
+	// whether the clock is synchronized with NTP, nil when that's unknown,
+	// and whether it's unsynchronized or off by more than ClockOffsetThreshold
+	Clock                *ClockSync    `json:"clock"`
+	HasClockAlert        bool          `json:"has_clock_alert"`
+	ClockOffsetThreshold time.Duration `json:"clock_offset_threshold"`
+
+	// all thermal zones, and the hottest of them (nil without sensors)
+	Temperatures []ThermalZone `json:"temperatures"`
+	Hottest      *ThermalZone  `json:"hottest"`
+
+	// the SMART health of the physical disks, empty without smartctl or
+	// when not running as root
+	SmartDisks []SmartDisk `json:"smart_disks"`
+
+	// disk entries over the configured block or inode threshold
+	HasDiskAlert   bool      `json:"has_disk_alert"`
+	DiskAlerts     []FsEntry `json:"disk_alerts"`
+	DiskThreshold  int       `json:"disk_threshold"`
+	InodeThreshold int       `json:"inode_threshold"`
+
+	// the total size and used space of the real file systems, see DiskTotals
+	DiskTotalSize uint64 `json:"disk_total_size"`
+	DiskTotalUsed uint64 `json:"disk_total_used"`
+
+	// whether the hottest zone exceeds TempThreshold, when configured
+	HasTempAlert  bool `json:"has_temp_alert"`
+	TempThreshold int  `json:"temp_threshold"`
+
+	// whether the swap usage exceeds SwapThreshold percent
+	HasSwapAlert  bool `json:"has_swap_alert"`
+	SwapThreshold int  `json:"swap_threshold"`
+
+	// the period the failed and recent logins are limited to, zero when
+	// they aren't
+	Window time.Duration `json:"window"`
+
+	// when ExtIp was fetched from the providers; earlier than Time when the
+	// address from the state was still fresh enough to be reused
+	ExtIpFetched time.Time `json:"ext_ip_fetched"`
+
+	// whether the external IP differs from the one in the previous report
+	ExtIpChanged  bool   `json:"ext_ip_changed"`
+	PreviousExtIp string `json:"previous_ext_ip"`
+
+	// the number of failed login IP addresses which weren't seen within the
+	// FailedIpRetention before, see AuthFailure.IsNew
+	NewFailureCount   int           `json:"new_failure_count"`
+	FailedIpRetention time.Duration `json:"failed_ip_retention"`
+
+	// the failed logins within the FailedLoginRateWindow, and whether there
+	// are more than FailedLoginRateThreshold of them: a brute-force attack
+	// going on now, rather than the usual background noise
+	FailedLoginRate          int           `json:"failed_login_rate"`
+	FailedLoginRateWindow    time.Duration `json:"failed_login_rate_window"`
+	FailedLoginRateThreshold int           `json:"failed_login_rate_threshold"`
+	HasLoginSpike            bool          `json:"has_login_spike"`
+
+	// the custom commands from the settings, with their output
+	Commands []CustomCommand `json:"commands"`
+
+	// the last lines of the log files from the LogTails setting
+	LogTails []LogTail `json:"log_tails"`
+
+	// the processes from the WatchedProcesses setting, and how often they
+	// started within the RespawnWindow. The ones which started at least
+	// RespawnThreshold times are crash looping.
+	Respawns         []Respawn     `json:"respawns"`
+	RespawnWindow    time.Duration `json:"respawn_window"`
+	RespawnThreshold int           `json:"respawn_threshold"`
+
+	// the failed systemd units, empty without systemd
+	FailedUnits []SystemdUnit `json:"failed_units"`
+
+	// the available package updates, nil without a supported package manager
+	Updates *PackageUpdates `json:"updates"`
+
+	// the users logged in now and the most recent logins. With KnownHosts
+	// configured, logins from other hosts since the previous report are
+	// counted as unfamiliar.
+	LoggedIn         []Login `json:"logged_in"`
+	RecentLogins     []Login `json:"recent_logins"`
+	UnfamiliarLogins int     `json:"unfamiliar_logins"`
+
+	// the sockets listening for connections. With AllowedPorts configured,
+	// the ones on other ports are counted as unexpected.
+	Listening       []ListeningSocket `json:"listening"`
+	UnexpectedPorts int               `json:"unexpected_ports"`
+
+	// everything noteworthy in the report, like a disk filling up, heavy
+	// swapping, the box running hot, a reboot, the external IP changing,
+	// (lots of) failed logins, failed systemd units, crash looping processes,
+	// security updates, logins from unfamiliar hosts or unexpected listening
+	// ports. The most severe come first, see BuildAlerts.
+	Alerts []Alert `json:"alerts"`
+
+	// the key metrics over the last few reports, from the history
+	Trends []Trend `json:"trends"`
+
+	// why collectors failed, by collector name: system, uptime, ip,
+	// interfaces, authlog, geoip, df, diskio, fail2ban, load, memory,
+	// processes, temperature, smart, clock, systemd, updates, logins,
+	// sockets, commands and logtails, and the registered collectors
+	Errors map[string]string `json:"errors"`
+
+	// the sections which weren't collected, by collector name
+	DisabledSections []string `json:"disabled_sections"`
+
+	// the results of the collectors registered with RegisterCollector, by
+	// their name
+	Extra map[string]interface{} `json:"extra"`
+}
+
+// Returns whether the section, by the name of its collector, is collected
+// rather than turned off with the DisabledSections setting.
+func (r *ReportData) Enabled(section string) bool {
+	for _, disabled := range r.DisabledSections {
+		if disabled == section {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The version of the JSON encoding of the report. Fields are only added, which
+// consumers can ignore; renaming or removing a field, or changing its type,
+// breaks them and raises the version. Version 1 had the fields by their Go
+// names and severities as numbers. testdata/report.json has the current
+// encoding, a test fails when it changes.
+const REPORT_SCHEMA_VERSION = 2
+
+// Encodes the report as JSON, with a schema_version next to the fields, so
+// consumers like dashboards can tell which fields to expect. This is what the
+// report server, the webhook and the JSON attachment send.
+func (r ReportData) MarshalJSON() ([]byte, error) {
+	// the alias has no methods, or this would recurse.
+	type reportData ReportData
+
+	return json.Marshal(struct {
+		SchemaVersion int `json:"schema_version"`
+		reportData
+	}{REPORT_SCHEMA_VERSION, reportData(r)})
+}
+
+// Returns whether anything noteworthy happened which is worth a mail on its
+// own, see Alerts.
+func (r *ReportData) HasAlert() bool {
+	return len(r.Alerts) > 0
+}
+
+// Returns the time between the previous report and this one, to the minute.
+// Zero before the first report.
+func (r *ReportData) SincePreviousReport() time.Duration {
+	if r.PreviousReport.IsZero() {
+		return 0
+	}
+
+	return r.Time.Sub(r.PreviousReport).Truncate(time.Minute)
+}
+
+// Returns whether there's an alert of at least the given severity.
+func (r *ReportData) HasAlertOf(min Severity) bool {
+	return r.MaxSeverity() >= min
+}
+
+// Returns the severity of the most severe alert, SEVERITY_NONE without any.
+func (r *ReportData) MaxSeverity() Severity {
+	max := SEVERITY_NONE
+	for _, a := range r.Alerts {
+		if a.Severity > max {
+			max = a.Severity
+		}
+	}
+
+	return max
+}
+
+// Returns whether there are security updates waiting to be installed.
+func (r *ReportData) HasSecurityUpdates() bool {
+	return r.Updates != nil && r.Updates.Security > 0
+}
+
+// Returns the number of alerts in this report.
+func (r *ReportData) AlertCount() int {
+	return len(r.Alerts)
+}
+
+// Returns a terse, single line summary of this report, like `2 disk alert(s),
+// 37 failed login(s), IP unchanged'. Meant for the output of unattended runs,
+// so cron or the journal shows that a report went out.
+func (r *ReportData) Summary() string {
+	parts := []string{fmt.Sprintf("%d disk alert(s)", len(r.DiskAlerts))}
+	if other := r.AlertCount() - len(r.DiskAlerts); other > 0 {
+		parts = append(parts, fmt.Sprintf("%d other alert(s)", other))
+	}
+
+	if _, failed := r.Errors["authlog"]; failed {
+		parts = append(parts, "failed logins unavailable")
+	} else {
+		total := 0
+		for _, f := range r.Failures {
+			total += f.Failures
+		}
+		parts = append(parts, fmt.Sprintf("%d failed login(s)", total))
+	}
+
+	switch {
+	case r.ExtIp == "":
+		parts = append(parts, "IP unknown")
+	case r.ExtIpChanged:
+		parts = append(parts, "IP changed to "+r.ExtIp)
+	default:
+		parts = append(parts, "IP unchanged")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// The period the time bounded parts of the report look back on, when none is
+// configured.
+const defaultReportWindow = 24 * time.Hour
+
+// Time since the previous report over which the gap is an alert, when none is
+// configured. A box reporting daily which skipped a report may have been down.
+const defaultReportGapThreshold = 48 * time.Hour
+
+// Runs all the collectors concurrently and gathers their results in a report.
+// The configuration is used to find out which optional collectors should be run,
+// the state of the previous run to find out what changed since then.
+// Collectors which fail, or don't finish within the CollectTimeout, leave
+// their part of the report empty, with the reason in Errors. Canceling the
+// context aborts the collectors which are still running; the partial report
+// is returned with the error of the context then.
+func CollectReport(parent context.Context, cfg Config) (ReportData, error) {
+	now := time.Now()
+	if !cfg.decoded {
+		if err := cfg.decode(); err != nil {
+			return ReportData{}, err
+		}
+	}
+	state := cfg.State
+	if state == nil {
+		state = &State{}
+	}
+
+	// the period the time bounded collectors look back on, like the failed
+	// and recent logins.
+	window := cfg.Window
+
+	// an invalid locale is no reason to skip the report, English will do.
+	locale := cfg.Locale
+	printer, err := NewPrinter(locale)
+	if err != nil {
+		slog.Warn("Falling back to English", "error", err)
+		locale, printer = "", englishPrinter
+	}
+
+	ctx, cancel := context.WithTimeout(parent, cfg.CollectTimeout)
+	defer cancel()
+
+	// the collectors are independent, so they run concurrently, the
+	// registered ones next to the built-in ones.
+	c := newCollection(ctx, cfg.DisabledSections)
+	for _, collector := range builtinCollectors(cfg, state.snapshot(), now) {
+		c.Go(collector)
+	}
+	registered := registeredCollectors()
+	for _, collector := range registered {
+		c.Go(collector)
+	}
+	results, errs := c.Wait()
+
+	// collectors which failed, didn't finish or were disabled have no
+	// result, which leaves their part of the report empty.
+	system, _ := results["system"].(SystemInfo)
+	var uptime string
+	up, hasUptime := results["uptime"].(time.Duration)
+	if hasUptime {
+		uptime = FormatDurationLocale(up, printer)
+	}
+	ip, _ := results["ip"].(extIpResult)
+	netwInterfaces, _ := results["interfaces"].([]InterfaceInfo)
+	auth, _ := results["authlog"].(authLogResult)
+	if auth.geoipErr != nil {
+		errs["geoip"] = auth.geoipErr.Error()
+	}
+	failures := auth.failures
+	fsEntry, _ := results["df"].([]FsEntry)
+	diskIO, _ := results["diskio"].([]DiskIO)
+	fail2ban, _ := results["fail2ban"].(*Fail2banReport)
+	load, _ := results["load"].(*LoadAverage)
+	memory, _ := results["memory"].(*MemoryInfo)
+	procs, _ := results["processes"].(topProcesses)
+	temperatures, _ := results["temperature"].([]ThermalZone)
+	smartDisks, _ := results["smart"].([]SmartDisk)
+	clock, _ := results["clock"].(*ClockSync)
+	failedUnits, _ := results["systemd"].([]SystemdUnit)
+	updates, _ := results["updates"].(*PackageUpdates)
+	logins, _ := results["logins"].(loginsResult)
+	loggedIn, recentLogins := logins.current, logins.recent
+	listening, _ := results["sockets"].([]ListeningSocket)
+	commands, _ := results["commands"].([]CustomCommand)
+	logTails, _ := results["logtails"].([]LogTail)
+
+	extra := make(map[string]interface{})
+	for _, collector := range registered {
+		if result, ok := results[collector.Name()]; ok {
+			extra[collector.Name()] = result
+		}
+	}
+
+	report := ReportData{
+		Time:       now,
+		Errors:     errs,
+		System:     system,
+		Uptime:     uptime,
+		Load:       load,
+		Memory:     memory,
+		ExtIp:      ip.address,
+		Interfaces: netwInterfaces,
+		Failures:   failures,
+		Fail2ban:   fail2ban,
+		FreeSpace:  fsEntry,
+		DiskIO:     diskIO,
+		TopCPU:     procs.byCPU,
+		TopMemory:  procs.byMemory,
+
+		UptimeSeconds: up.Seconds(),
+		Window:        window,
+		ExtIpFetched:  ip.fetched,
+		Locale:        locale,
+
+		Clock:                clock,
+		ClockOffsetThreshold: cfg.ClockOffset,
+
+		Temperatures: temperatures,
+		Hottest:      HottestZone(temperatures),
+		SmartDisks:   smartDisks,
+
+		DiskAlerts:     DiskAlerts(fsEntry, cfg.DiskThreshold, cfg.InodeThreshold),
+		DiskThreshold:  cfg.DiskThreshold,
+		InodeThreshold: cfg.InodeThreshold,
+		TempThreshold:  cfg.TempThreshold,
+		SwapThreshold:  cfg.SwapThreshold,
+
+		RebootThreshold: cfg.RebootThreshold,
+
+		PreviousReport: state.Time,
+		GapThreshold:   cfg.GapThreshold,
+
+		FailedIpRetention: cfg.FailedIpRetention,
+
+		FailedLoginRateWindow:    cfg.RateWindow,
+		FailedLoginRateThreshold: cfg.RateThreshold,
+
+		Respawns:         procs.respawns,
+		RespawnWindow:    cfg.RespawnWindow,
+		RespawnThreshold: cfg.RespawnThreshold,
+
+		Commands:    commands,
+		LogTails:    logTails,
+		FailedUnits: failedUnits,
+		Updates:     updates,
+
+		LoggedIn:     loggedIn,
+		RecentLogins: recentLogins,
+
+		Listening: listening,
+
+		DisabledSections: cfg.DisabledSections,
+		Extra:            extra,
+	}
+	report.HasDiskAlert = len(report.DiskAlerts) > 0
+	report.DiskTotalSize, report.DiskTotalUsed = DiskTotals(fsEntry)
+	// temperature alerts are opt-in, a sane limit differs per device.
+	if report.Hottest != nil && cfg.TempThreshold > 0 {
+		report.HasTempAlert = report.Hottest.Celsius > float64(cfg.TempThreshold)
+	}
+	if memory != nil && memory.SwapTotal > 0 && cfg.SwapThreshold > 0 {
+		report.HasSwapAlert = memory.SwapUsedPercentage() > float64(cfg.SwapThreshold)
+	}
+	if hasUptime {
+		report.BootTime = now.Add(-up).Truncate(time.Second)
+		report.RecentlyRebooted = up < cfg.RebootThreshold
+	}
+	if clock != nil {
+		offset := clock.Offset
+		if offset < 0 {
+			offset = -offset
+		}
+		report.HasClockAlert = !clock.Synchronized || (cfg.ClockOffset > 0 && offset > cfg.ClockOffset)
+	}
+	if !state.Time.IsZero() && cfg.GapThreshold > 0 {
+		report.HasReportGap = report.SincePreviousReport() > cfg.GapThreshold
+	}
+
+	// an unknown IP, either now or previously, is not a change.
+	if ip.address != "" && state.ExtIp != "" && ip.address != state.ExtIp {
+		report.ExtIpChanged = true
+		report.PreviousExtIp = state.ExtIp
+	}
+
+	// only new unfamiliar logins are an alert, not the same one every report.
+	MarkUnfamiliarLogins(loggedIn, cfg.KnownHosts)
+	MarkUnfamiliarLogins(recentLogins, cfg.KnownHosts)
+	for _, login := range recentLogins {
+		if login.Unfamiliar && login.Time.After(state.Time) {
+			report.UnfamiliarLogins++
+		}
+	}
+
+	report.UnexpectedPorts = MarkUnexpectedPorts(listening, cfg.AllowedPorts)
+
+	// without addresses from a previous run, every one of them would be new.
+	if state.FailedIps != nil {
+		for i := range failures {
+			if !state.SeenFailure(failures[i].IPAddress, now, cfg.FailedIpRetention) {
+				failures[i].IsNew = true
+				report.NewFailureCount++
+			}
+		}
+	}
+	for _, f := range failures {
+		report.FailedLoginRate += f.Recent
+	}
+	if cfg.RateWindow > 0 && cfg.RateThreshold > 0 {
+		report.HasLoginSpike = report.FailedLoginRate > cfg.RateThreshold
+	}
+
+	report.Alerts = BuildAlerts(&report, cfg.AlertLimits)
+	report.Trends = BuildTrends(cfg.History, &report)
+
+	return report, parent.Err()
+}
+
+// The results of the built-in collectors which collect more than one thing.
+type extIpResult struct {
+	address string
+	// when the address was fetched, or the time of the state it came from
+	fetched time.Time
+}
+
+type authLogResult struct {
+	failures []AuthFailure
+	// why the failures couldn't be located, the report can do without
+	geoipErr error
+}
+
+type topProcesses struct {
+	byCPU, byMemory []Process
+	respawns        []Respawn
+}
+
+type loginsResult struct {
+	current, recent []Login
+}
+
+// Returns the collectors of the built-in sections of the report, see
+// reportSections. The optional ones are left out when they aren't
+// configured. The collectors get a copy of the state of the previous report,
+// since one which doesn't finish in time keeps running while the state is
+// updated for the next report.
+func builtinCollectors(cfg Config, state State, now time.Time) []Collector {
+	cfg.State = nil
+	collectors := []Collector{
+		NewCollector("system", func(ctx context.Context) (interface{}, error) {
+			return GetSystemInfo()
+		}),
+		NewCollector("uptime", func(ctx context.Context) (interface{}, error) {
+			up, err := GetUptime()
+			if err != nil {
+				return nil, err
+			}
+			return up, nil
+		}),
+		// the address of the previous run is reused while it's fresh, so the
+		// providers aren't asked over and over.
+		NewCollector("ip", func(ctx context.Context) (interface{}, error) {
+			if state.ExtIp != "" && now.Sub(state.ExtIpFetched) < cfg.ExtIpCacheTTL {
+				return extIpResult{state.ExtIp, state.ExtIpFetched}, nil
+			}
+			ip, err := GetExtIPAddressFromConfig(ctx, cfg)
+			return extIpResult{ip, now}, err
+		}),
+		NewCollector("interfaces", func(ctx context.Context) (interface{}, error) {
+			infos, err := GetInterfaces(ctx)
+			infos = FilterInterfaces(infos, cfg.InterfaceFilter)
+			if !state.Time.IsZero() {
+				ApplyNetDeltas(infos, state.NetCounters, now.Sub(state.Time))
+			}
+			return infos, err
+		}),
+		// the failed logins are enriched with locations and hostnames, which
+		// depends on the failures, so that's done in the same collector.
+		NewCollector("authlog", func(ctx context.Context) (interface{}, error) {
+			f, err := AnalyzeAuthLog(ctx, cfg.AuthLog)
+			if err != nil {
+				return nil, err
+			}
+
+			var geoipErr error
+			if cfg.GeoIPDatabase != "" {
+				geoipErr = runCollector("geoip", func() error {
+					return EnrichGeoIP(f, cfg.GeoIPDatabase)
+				})
+			}
+			// reverse DNS is opt-in, it's slow and tells the resolver who attacked us.
+			if cfg.ResolveHostnames {
+				runCollector("resolve", func() error {
+					ResolveHostnames(ctx, f, cfg.ResolveTimeout)
+					return nil
+				})
+			}
+			return authLogResult{f, geoipErr}, nil
+		}),
+		// the fullest file systems go first, the rest stays in the order of df.
+		NewCollector("df", func(ctx context.Context) (interface{}, error) {
+			entries, err := GetFreeDiskSpaceFromConfig(ctx, cfg)
+			sort.Stable(FsEntries(entries))
+			return entries, err
+		}),
+		NewCollector("diskio", func(ctx context.Context) (interface{}, error) {
+			return GetDiskIO(ctx, cfg.DiskIOAll)
+		}),
+		// only render the load section when it could actually be read.
+		NewCollector("load", func(ctx context.Context) (interface{}, error) {
+			l, err := GetLoadAverage()
+			if err != nil {
+				return nil, err
+			}
+			return &l, nil
+		}),
+		NewCollector("memory", func(ctx context.Context) (interface{}, error) {
+			m, err := GetMemoryInfo()
+			if err != nil {
+				return nil, err
+			}
+			return &m, nil
+		}),
+		NewCollector("processes", func(ctx context.Context) (interface{}, error) {
+			procs, err := listProcesses(ctx)
+			if err != nil {
+				return nil, err
+			}
+			// the watched processes are looked for among all of them, not
+			// just the top ones.
+			respawns := TrackRespawns(procs, cfg.WatchedProcesses, state.ProcessStarts, now, cfg.RespawnWindow, cfg.RespawnThreshold)
+			byCPU, byMemory := sortTopProcesses(procs, cfg.TopProcessCount)
+			return topProcesses{byCPU, byMemory, respawns}, nil
+		}),
+		NewCollector("temperature", func(ctx context.Context) (interface{}, error) {
+			return GetCPUTemperature()
+		}),
+		NewCollector("smart", func(ctx context.Context) (interface{}, error) {
+			return GetSmartHealth(ctx)
+		}),
+		NewCollector("clock", func(ctx context.Context) (interface{}, error) {
+			return GetClockSync(ctx)
+		}),
+		NewCollector("systemd", func(ctx context.Context) (interface{}, error) {
+			return GetFailedUnits(ctx)
+		}),
+		NewCollector("updates", func(ctx context.Context) (interface{}, error) {
+			return GetPackageUpdates(ctx, cfg.PackageManager)
+		}),
+		NewCollector("logins", func(ctx context.Context) (interface{}, error) {
+			current, err := GetLoggedInUsers()
+			if err != nil {
+				return nil, err
+			}
+			var since time.Time
+			if cfg.Window > 0 {
+				since = now.Add(-cfg.Window)
+			}
+			recent, err := GetRecentLogins(cfg.RecentLoginCount, since)
+			return loginsResult{current, recent}, err
+		}),
+		NewCollector("sockets", func(ctx context.Context) (interface{}, error) {
+			return GetListeningSockets()
+		}),
+	}
+
+	// fail2ban is optional, only analyze its log when configured.
+	if cfg.Fail2banLog != "" {
+		collectors = append(collectors, NewCollector("fail2ban", func(ctx context.Context) (interface{}, error) {
+			return AnalyzeFail2banLog(cfg.Fail2banLog)
+		}))
+	}
+	// custom commands each report their own failure, so one failing command
+	// doesn't hide the output of the others. The output goes in a copy, the
+	// configuration is used for every report.
+	if len(cfg.Commands) > 0 {
+		cmds := append([]CustomCommand(nil), cfg.Commands...)
+		collectors = append(collectors, NewCollector("commands", func(ctx context.Context) (interface{}, error) {
+			RunCustomCommands(ctx, cmds, cfg.CommandTimeout, cfg.CommandMaxOutput)
+			return cmds, nil
+		}))
+	}
+	if tails := ParseLogTails(cfg.LogTails); len(tails) > 0 {
+		collectors = append(collectors, NewCollector("logtails", func(ctx context.Context) (interface{}, error) {
+			ReadLogTails(tails)
+			return tails, nil
+		}))
+	}
+
+	// the sections this platform can't collect say so in the report, rather
+	// than failing on a missing /proc file.
+	for i, c := range collectors {
+		if isUnsupportedSection(c.Name()) {
+			collectors[i] = NewCollector(c.Name(), func(ctx context.Context) (interface{}, error) {
+				return nil, errUnsupportedPlatform
+			})
+		}
+	}
+
+	return collectors
+}
+
+// Parses the HTML template at templatePath, or the default template when the
+// path is empty. The functions are made available to the template.
+func loadTemplate(templatePath string, funcs template.FuncMap) (*htmltemplate.Template, error) {
+	if templatePath == "" {
+		return htmltemplate.New("default").Funcs(htmltemplate.FuncMap(funcs)).Parse(defaultTemplate)
+	}
+
+	tmpl, err := htmltemplate.New(filepath.Base(templatePath)).Funcs(htmltemplate.FuncMap(funcs)).ParseFiles(templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse template `%s': %s", templatePath, err)
+	}
+
+	return tmpl, nil
+}
+
+// Returns the functions available to the report templates. Without a
+// Locale, numbers are formatted like they always were, without separators.
+func templateFuncs(report *ReportData) template.FuncMap {
+	p := printerOrEnglish(report.Locale)
+	sprintf := fmt.Sprintf
+	if report.Locale != "" {
+		sprintf = func(format string, a ...interface{}) string { return p.Sprintf(format, a...) }
+	}
+
+	return template.FuncMap{
+		"bytes": func(n uint64) string { return formatBytesWith(n, sprintf) },
+		"diskAlert": func(fs FsEntry) bool {
+			return len(DiskAlerts([]FsEntry{fs}, report.DiskThreshold, report.InodeThreshold)) > 0
+		},
+		"T":        func(key string) string { return p.Sprintf(key) },
+		"duration": func(d time.Duration) string { return FormatDurationLocale(d, p) },
+		"num":      func(n int) string { return sprintf("%d", n) },
+	}
+}
+
+// The data the mail subject is rendered with: the report, plus a few
+// shorthands which are convenient in a subject.
+type subjectData struct {
+	*ReportData
+	Host string
+	// Date of the report, as yyyy-mm-dd
+	Date string
+}
+
+// Renders the mail subject as a template, so subjects can differ per machine
+// and per day, like "{{ .Host }} report {{ .Date }} ({{ .AlertCount }} alerts)".
+// Next to Host and Date, the subject has access to the whole report. A subject
+// without any template actions is used as is. Returns an error when the
+// subject is not a valid template.
+func PrepareSubject(subject string, report *ReportData) (string, error) {
+	if !strings.Contains(subject, "{{") {
+		return subject, nil
+	}
+
+	tmpl, err := template.New("subject").Funcs(templateFuncs(report)).Parse(subject)
+	if err != nil {
+		return "", fmt.Errorf("Invalid MailSubject template: %s", err)
+	}
+
+	data := subjectData{report, report.System.Hostname, report.Time.Format("2006-01-02")}
+	bytebuf := bytes.Buffer{}
+	if err = tmpl.Execute(&bytebuf, data); err != nil {
+		return "", fmt.Errorf("Error in subject template execution: %s", err)
+	}
+
+	return bytebuf.String(), nil
+}
+
+// Prepares the mail body by rendering the collected report in an HTML
+// template. That's the template at templatePath, or the default template
+// when the path is empty. The values are HTML escaped, usernames and
+// hostnames from the logs are whatever an attacker made them. Returns an
+// error when the template can't be parsed or executed.
+func PrepareMail(report *ReportData, templatePath string) (string, error) {
+	tmpl, err := loadTemplate(templatePath, templateFuncs(report))
+	if err != nil {
+		return "", err
+	}
+
+	bytebuf := bytes.Buffer{}
+	if err = tmpl.Execute(&bytebuf, report); err != nil {
+		return "", fmt.Errorf("Error in template execution: %s", err)
+	}
+
+	return bytebuf.String(), nil
+}
+
+// Prepares the plain text alternative of the mail body, for mail clients which
+// don't show HTML.
+func PrepareText(report *ReportData) (string, error) {
+	tmpl, err := template.New("text").Funcs(templateFuncs(report)).Parse(defaultTextTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	bytebuf := bytes.Buffer{}
+	if err = tmpl.Execute(&bytebuf, report); err != nil {
+		return "", fmt.Errorf("Error in text template execution: %s", err)
+	}
+
+	return bytebuf.String(), nil
+}
+
+// Writes the rendered report to the given file with 0644 permissions, so
+// other tools can pick it up. The directory must exist already.
+func WriteReport(file string, body string) error {
+	dir := path.Dir(file)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("Output directory `%s' does not exist", dir)
+	}
+
+	if err := ioutil.WriteFile(file, []byte(body), 0644); err != nil {
+		return fmt.Errorf("Unable to write report to `%s': %s", file, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// Values from the logs and from /proc are chosen by attackers or local users,
+// so they must come out of the HTML template escaped.
+func TestPrepareMailEscapes(t *testing.T) {
+	tests := []struct {
+		name   string
+		report ReportData
+		want   string
+	}{
+		{
+			name: "attempted username",
+			report: ReportData{Failures: []AuthFailure{
+				{IPAddress: "192.0.2.1", Failures: 3, Usernames: map[string]int{"<script>alert(1)</script>": 3}},
+			}},
+			want: "&lt;script&gt;alert(1)&lt;/script&gt;",
+		},
+		{
+			name: "reverse DNS",
+			report: ReportData{Failures: []AuthFailure{
+				{IPAddress: "192.0.2.1", Failures: 3, PTR: "<img src=x>"},
+			}},
+			want: "&lt;img src=x&gt;",
+		},
+		{
+			name: "PAM rhost",
+			report: ReportData{Failures: []AuthFailure{
+				{IPAddress: "<img src=x onerror=alert(1)>", Failures: 3},
+			}},
+			want: "&lt;img src=x onerror=alert(1)&gt;",
+		},
+		{
+			name: "process command",
+			report: ReportData{
+				TopCPU:    []Process{{PID: 1, Command: "<script>cpu</script>", User: "root"}},
+				TopMemory: []Process{{PID: 2, Command: "<script>mem</script>", User: "root"}},
+			},
+			want: "&lt;script&gt;mem&lt;/script&gt;",
+		},
+		{
+			name: "login",
+			report: ReportData{
+				LoggedIn:     []Login{{User: "<script>user</script>", TTY: "pts/0", Host: "<img src=x>"}},
+				RecentLogins: []Login{{User: "root", TTY: "pts/1", Host: "<img src=y>"}},
+			},
+			want: "&lt;script&gt;user&lt;/script&gt;",
+		},
+		{
+			name: "location",
+			report: ReportData{Failures: []AuthFailure{
+				{IPAddress: "192.0.2.1", Failures: 3, Country: "<img src=x>", City: "<script>city</script>"},
+			}},
+			want: "&lt;script&gt;city&lt;/script&gt;",
+		},
+	}
+
+	for _, test := range tests {
+		body, err := PrepareMail(&test.report, "")
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !strings.Contains(body, test.want) {
+			t.Errorf("%s: expected %q in the report", test.name, test.want)
+		}
+		if strings.Contains(body, "<script>") || strings.Contains(body, "<img") {
+			t.Errorf("%s: unescaped markup in the report", test.name)
+		}
+	}
+}
+
+// Fills every exported field of the value, recursively, with something other
+// than its zero value: a slice or map gets one element, a pointer a value.
+// Strings are named after their field, so the golden file tells which field
+// is which.
+func fillValue(v reflect.Value, name string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2024, 1, 15, 10, 23, 45, 0, time.UTC)))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() {
+				fillValue(v.Field(i), field.Name)
+			}
+		}
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fillValue(v.Elem(), name)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fillValue(v.Index(0), name)
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		elem := reflect.New(v.Type().Elem()).Elem()
+		fillValue(elem, name)
+		v.SetMapIndex(reflect.ValueOf(strings.ToLower(name)), elem)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(name))
+	case reflect.String:
+		v.SetString(name)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(2)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(3)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	}
+}
+
+// Returns the exported fields of the type, and of the types it's made of,
+// which have no json tag.
+func untaggedFields(t reflect.Type, seen map[reflect.Type]bool) []string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.PkgPath() != reflect.TypeOf(ReportData{}).PkgPath() || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	var untagged []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if _, ok := field.Tag.Lookup("json"); !ok {
+			untagged = append(untagged, t.Name()+"."+field.Name)
+		}
+		untagged = append(untagged, untaggedFields(field.Type, seen)...)
+	}
+
+	return untagged
+}
+
+// The JSON encoding of the report is a contract with its consumers. Every
+// field has a json tag, so renaming a Go field doesn't rename it in JSON, and
+// a fully populated report is compared with testdata/report.json. When that
+// changes on purpose, run go test -update and raise REPORT_SCHEMA_VERSION
+// unless fields were only added.
+func TestReportDataJSON(t *testing.T) {
+	for _, field := range untaggedFields(reflect.TypeOf(ReportData{}), make(map[reflect.Type]bool)) {
+		t.Errorf("%s has no json tag", field)
+	}
+
+	var report ReportData
+	fillValue(reflect.ValueOf(&report).Elem(), "")
+	report.Alerts[0].Severity = SEVERITY_WARNING
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded = append(encoded, '\n')
+
+	golden := filepath.Join("testdata", "report.json")
+	if *update {
+		if err := ioutil.WriteFile(golden, encoded, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(encoded, want) {
+		t.Errorf("the JSON encoding of the report differs from %s, run go test -update when that's intended:\n%s", golden, encoded)
+	}
+}
+
+// A collector which is still running after the collection timed out reads a
+// copy of the state, not the state which is updated for the next report.
+func TestBuiltinCollectorsStateSnapshot(t *testing.T) {
+	now := time.Now()
+	cfg, err := NewConfig(map[string]string{SETTING_IP_CACHE_TTL: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &State{
+		ExtIp:         "192.0.2.1",
+		ExtIpFetched:  now.Add(-time.Minute),
+		Time:          now.Add(-time.Hour),
+		NetCounters:   map[string]NetCounters{"eth0": {RxBytes: 1, TxBytes: 2}},
+		ProcessStarts: map[string][]time.Time{"flaky": {now.Add(-time.Hour)}},
+	}
+
+	for _, collector := range builtinCollectors(cfg, state.snapshot(), now) {
+		if collector.Name() != "ip" {
+			continue
+		}
+		done := make(chan interface{})
+		go func() {
+			result, _ := collector.Collect(context.Background())
+			done <- result
+		}()
+		state.Update(&ReportData{Time: now, ExtIp: "192.0.2.2", ExtIpFetched: now})
+		if got := (<-done).(extIpResult); got.address != "192.0.2.1" {
+			t.Errorf("expected the address of the previous report, got %s", got.address)
+		}
+	}
+
+	snapshot := state.snapshot()
+	snapshot.NetCounters["eth1"] = NetCounters{}
+	snapshot.ProcessStarts["other"] = nil
+	if len(state.NetCounters) != 0 || len(state.ProcessStarts) != 0 {
+		t.Errorf("expected the snapshot not to share the maps of the state, got %v and %v", state.NetCounters, state.ProcessStarts)
+	}
+}
+
+// The Slack message shows the alerts of the report, the failed logins over
+// the warning threshold too, with the emoji of their severity.
+func TestSlackMessage(t *testing.T) {
+	report := &ReportData{Failures: []AuthFailure{{IPAddress: "192.0.2.1", Failures: 150}}}
+	report.Alerts = BuildAlerts(report, AlertLimits{DiskCritical: defaultDiskCritical, FailedLoginWarning: defaultFailedLoginWarning, FailedLoginCritical: defaultFailedLoginCritical})
+
+	msg := slackMessage(report)
+	if len(msg.Blocks) != 3 || msg.Blocks[1].Text == nil {
+		t.Fatalf("expected a header, the alerts and a context line, got %+v", msg.Blocks)
+	}
+	if want := ":warning: *failed logins*: 150 from 1 IP address(es), 0 new since the previous report\n"; msg.Blocks[1].Text.Text != want {
+		t.Errorf("expected %q, got %q", want, msg.Blocks[1].Text.Text)
+	}
+
+	if got := slackMessage(&ReportData{}).Blocks[1].Text.Text; got != ":white_check_mark: Nothing to report" {
+		t.Errorf("expected nothing to report without alerts, got %q", got)
+	}
+}
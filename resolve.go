@@ -0,0 +1,54 @@
+package stats
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for reverse DNS lookups.
+const (
+	defaultResolveTimeout = 2 * time.Second
+	resolveWorkers        = 8
+)
+
+// Looks up the host name (PTR record) of the IP address of every failure, and
+// stores it in the PTR field. Lookups are done by a small pool of workers, and
+// each lookup is bounded by the timeout, so a long list of failures or a slow
+// resolver can't hang the report. Failed lookups leave the PTR field empty.
+func ResolveHostnames(ctx context.Context, failures []AuthFailure, timeout time.Duration) {
+	indices := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < resolveWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				failures[i].PTR = lookupPTR(ctx, failures[i].IPAddress, timeout)
+			}
+		}()
+	}
+
+	for i := range failures {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// Returns the first host name of the IP address, without the trailing dot,
+// or an empty string when it has none or the lookup timed out.
+func lookupPTR(ctx context.Context, ip string, timeout time.Duration) string {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(names[0], ".")
+}
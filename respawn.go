@@ -0,0 +1,107 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Defaults for the respawn detection, when none are configured: a watched
+// process which started three times within a day is crash looping.
+const (
+	defaultRespawnWindow    = 24 * time.Hour
+	defaultRespawnThreshold = 3
+)
+
+// A process from the WatchedProcesses setting, and how often it started
+// recently. A process which keeps being restarted, like by systemd, is
+// running most of the time, yet it's crash looping.
+type Respawn struct {
+	// The command of the process, as in /proc/<pid>/stat
+	Name string `json:"name"`
+	// The oldest running process by that name, zero when none is running
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	// When it started within the RespawnWindow, the oldest first, as far as
+	// the reports saw: a process which started twice between two reports
+	// only shows up once.
+	Starts []time.Time `json:"starts"`
+	// Whether it started at least RespawnThreshold times within the window
+	CrashLoop bool `json:"crash_loop"`
+}
+
+// Returns the estimated time between the starts within the window, zero
+// with fewer than two of them. Since starts between reports are missed, it's
+// at most this.
+func (r Respawn) Interval() time.Duration {
+	if len(r.Starts) < 2 {
+		return 0
+	}
+
+	return r.Starts[len(r.Starts)-1].Sub(r.Starts[0]) / time.Duration(len(r.Starts)-1)
+}
+
+// Returns a simple string representation of this struct.
+func (r Respawn) String() string {
+	if r.Started.IsZero() {
+		return fmt.Sprintf("%s: not running, started %d time(s)", r.Name, len(r.Starts))
+	}
+
+	s := fmt.Sprintf("%s (%d): started %d time(s)", r.Name, r.PID, len(r.Starts))
+	if interval := r.Interval(); interval > 0 {
+		s += fmt.Sprintf(", about every %s", FormatDuration(interval))
+	}
+
+	return s
+}
+
+// Tracks the starts of the watched processes. The start times of the
+// previous reports, by process name, are from the state. The oldest running
+// process of a name is the one which counts, so workers which a master
+// process respawns don't. Start times before the window are forgotten, so
+// a process which has been running for longer has no starts at all.
+func TrackRespawns(procs []Process, watched []string, previous map[string][]time.Time, now time.Time, window time.Duration, threshold int) []Respawn {
+	oldest := make(map[string]Process)
+	for _, proc := range procs {
+		if proc.Started.IsZero() {
+			continue
+		}
+		if o, ok := oldest[proc.Command]; !ok || proc.Started.Before(o.Started) {
+			oldest[proc.Command] = proc
+		}
+	}
+
+	respawns := make([]Respawn, 0, len(watched))
+	for _, name := range watched {
+		r := Respawn{Name: name, Starts: make([]time.Time, 0)}
+		starts := previous[name]
+		if proc, ok := oldest[name]; ok {
+			r.PID, r.Started = proc.PID, proc.Started
+			if !containsTime(starts, proc.Started) {
+				starts = append(starts, proc.Started)
+			}
+		}
+		for _, start := range starts {
+			if now.Sub(start) < window {
+				r.Starts = append(r.Starts, start)
+			}
+		}
+		sort.Slice(r.Starts, func(i, j int) bool { return r.Starts[i].Before(r.Starts[j]) })
+		r.CrashLoop = threshold > 0 && len(r.Starts) >= threshold
+
+		respawns = append(respawns, r)
+	}
+
+	return respawns
+}
+
+// Returns whether the time is in the list.
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, u := range times {
+		if u.Equal(t) {
+			return true
+		}
+	}
+
+	return false
+}
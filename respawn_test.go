@@ -0,0 +1,72 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+// A watched process which keeps starting is crash looping, one which keeps
+// running isn't, however many of its workers are respawned. The starts are
+// carried from one report to the next by the state.
+func TestTrackRespawns(t *testing.T) {
+	boot := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return boot.Add(time.Duration(minutes) * time.Minute) }
+	state := &State{}
+
+	// runs a report every hour, with the processes running by then.
+	run := func(hour int, procs ...Process) []Respawn {
+		now := at(hour * 60)
+		report := ReportData{
+			Time:     now,
+			Respawns: TrackRespawns(procs, []string{"flaky", "nginx", "gone"}, state.ProcessStarts, now, 4*time.Hour, 3),
+		}
+		state.Update(&report)
+		return report.Respawns
+	}
+	nginx := []Process{
+		{PID: 10, Command: "nginx", Started: at(1)},
+		{PID: 11, Command: "nginx", Started: at(2)},
+	}
+
+	tests := []struct {
+		hour      int
+		procs     []Process
+		starts    []int
+		crashLoop bool
+	}{
+		{1, append(nginx, Process{PID: 20, Command: "flaky", Started: at(1)}), []int{1, 1, 0}, false},
+		// the same process, nothing started.
+		{2, append(nginx, Process{PID: 20, Command: "flaky", Started: at(1)}), []int{1, 1, 0}, false},
+		{3, append(nginx, Process{PID: 30, Command: "flaky", Started: at(150)}), []int{2, 1, 0}, false},
+		// a worker of nginx was respawned, its master is still running.
+		{4, append(nginx, Process{PID: 40, Command: "flaky", Started: at(230)}, Process{PID: 12, Command: "nginx", Started: at(200)}), []int{3, 1, 0}, true},
+		// not running now, the starts within the window still count.
+		{5, nginx, []int{2, 0, 0}, false},
+	}
+
+	for _, test := range tests {
+		respawns := run(test.hour, test.procs...)
+		if len(respawns) != 3 {
+			t.Fatalf("hour %d: expected 3 watched processes, got %d", test.hour, len(respawns))
+		}
+		for i, r := range respawns {
+			if len(r.Starts) != test.starts[i] {
+				t.Errorf("hour %d: expected %d start(s) of %s, got %v", test.hour, test.starts[i], r.Name, r.Starts)
+			}
+		}
+		if respawns[0].CrashLoop != test.crashLoop {
+			t.Errorf("hour %d: expected crash loop %t for %s", test.hour, test.crashLoop, respawns[0].Name)
+		}
+		if respawns[1].PID != 10 {
+			t.Errorf("hour %d: expected the oldest nginx process, got %d", test.hour, respawns[1].PID)
+		}
+		if !respawns[2].Started.IsZero() {
+			t.Errorf("hour %d: expected %s not to be running", test.hour, respawns[2].Name)
+		}
+	}
+
+	r := Respawn{Starts: []time.Time{at(0), at(30), at(90)}}
+	if got := r.Interval(); got != 45*time.Minute {
+		t.Errorf("expected an interval of 45m, got %s", got)
+	}
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Defaults for delivering through a local sendmail.
+const (
+	defaultSendmailPath = "/usr/sbin/sendmail"
+	// time the MTA gets to accept the message, it only has to queue it
+	sendmailTimeout = time.Minute
+)
+
+// Delivers the message through the local MTA, by piping it into its sendmail
+// binary (or a compatible one, like exim or msmtp). The recipients are given
+// on the command line rather than read from the headers with -t, so the
+// envelope matches the SMTP delivery, and the Bcc addresses, which aren't in
+// the headers, get the mail too. Returns an error with what sendmail wrote to
+// stderr when it exits with a failure.
+func DeliverSendmail(sendmailPath string, ms *MailSettings, message []byte) error {
+	recipients, err := ms.Recipients()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendmailTimeout)
+	defer cancel()
+
+	// -i keeps a line with a single dot from ending the message early.
+	args := append([]string{"-i", "-f", ms.FromAddress, "--"}, recipients...)
+	cmd := exec.CommandContext(ctx, sendmailPath, args...)
+	cmd.WaitDelay = killWaitDelay
+	// a local MTA expects local line endings, like a Maildir does.
+	cmd.Stdin = bytes.NewReader(bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n")))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	slog.Debug("Delivering mail through sendmail", "sendmail", sendmailPath, "to", recipients)
+	if err = cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("`%s' failed: %s: %s", sendmailPath, err, msg)
+		}
+		return fmt.Errorf("`%s' failed: %s", sendmailPath, err)
+	}
+
+	return nil
+}
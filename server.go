@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long a collected report is served before collecting a new one, when
+// nothing else is configured.
+const DefaultServeCacheTTL = 10 * time.Second
+
+// Serves the report over HTTP:
+//
+//	/report       the report rendered with the HTML template of the mail
+//	/report.json  the report as JSON
+//	/metrics      the report as Prometheus metrics, when enabled
+//
+// Reports are collected on request, and then cached for a short while so
+// rapid requests don't run df and friends over and over.
+type ReportServer struct {
+	Config   Config
+	CacheTTL time.Duration
+	// Whether to serve /metrics
+	Metrics bool
+
+	// guards the cached report, and makes concurrent requests wait for a
+	// single collection.
+	mu        sync.Mutex
+	report    *ReportData
+	collected time.Time
+}
+
+// Returns the cached report, or collects a new one when the cached one is
+// too old.
+func (s *ReportServer) Report(ctx context.Context) (ReportData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.report != nil && time.Since(s.collected) < s.CacheTTL {
+		return *s.report, nil
+	}
+
+	report, err := CollectReport(ctx, s.Config)
+	if err != nil {
+		return report, err
+	}
+	s.report = &report
+	s.collected = time.Now()
+	// nothing else is kept between reports, but the external IP is, so the
+	// providers aren't asked on every collection.
+	if s.Config.State != nil {
+		s.Config.State.UpdateExtIp(&report)
+	}
+
+	return report, nil
+}
+
+// Returns the handler serving the report endpoints.
+func (s *ReportServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/report", s.serveHTML)
+	mux.HandleFunc("/report.json", s.serveJSON)
+	if s.Metrics {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(reportCollector{s})
+		mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	}
+
+	return mux
+}
+
+// Serves the report rendered with the same template as the mail.
+func (s *ReportServer) serveHTML(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Report(r.Context())
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	body, err := PrepareMail(&report, s.Config.TemplatePath)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Write([]byte(body))
+}
+
+// Serves the report as JSON.
+func (s *ReportServer) serveJSON(w http.ResponseWriter, r *http.Request) {
+	report, err := s.Report(r.Context())
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// Logs the error, and tells the client something went wrong.
+func serveError(w http.ResponseWriter, err error) {
+	slog.Error("Unable to serve the report", "error", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,145 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The SMART health of a physical disk, as smartctl reports it.
+type SmartDisk struct {
+	// Name of the disk, e.g. sda or nvme0n1
+	Device string `json:"device"`
+	Model  string `json:"model"`
+	// The verdict of the health self-assessment, like PASSED, FAILED! or OK
+	Health string `json:"health"`
+	Passed bool   `json:"passed"`
+	// Sectors which were remapped because they went bad, and the unstable
+	// ones waiting to be. Both are early signs of a disk failing.
+	ReallocatedSectors int64 `json:"reallocated_sectors"`
+	PendingSectors     int64 `json:"pending_sectors"`
+	// Zero when the disk doesn't report its temperature
+	Celsius int `json:"celsius"`
+}
+
+// Returns a simple string representation of this struct.
+func (d SmartDisk) String() string {
+	str := d.Device
+	if d.Model != "" {
+		str += " (" + d.Model + ")"
+	}
+	str += ": " + d.Health
+	if d.ReallocatedSectors > 0 || d.PendingSectors > 0 {
+		str += fmt.Sprintf(", %d reallocated and %d pending sectors", d.ReallocatedSectors, d.PendingSectors)
+	}
+	if d.Celsius > 0 {
+		str += fmt.Sprintf(", %d °C", d.Celsius)
+	}
+
+	return str
+}
+
+// Gets the SMART health of the physical disks in /sys/block with smartctl.
+// Reading SMART data takes root and smartmontools, without either nothing is
+// returned, rather than an error. Disks which don't support SMART, like the
+// virtual disks of most VMs, are skipped.
+func GetSmartHealth(ctx context.Context) ([]SmartDisk, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil, nil
+	}
+
+	dirs, err := filepath.Glob("/sys/block/*")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list block devices: %s", err)
+	}
+
+	disks := make([]SmartDisk, 0)
+	for _, dir := range dirs {
+		// only physical disks have a device behind them, unlike loop, ram,
+		// device mapper or md devices.
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue
+		}
+		name := strings.ReplaceAll(filepath.Base(dir), "!", "/")
+
+		cmd := exec.CommandContext(ctx, "smartctl", "-H", "-i", "-A", "/dev/"+name)
+		cmd.Env = append(os.Environ(), "LC_ALL=C")
+		cmd.WaitDelay = killWaitDelay
+		// smartctl exits with a bit mask, which is non-zero for a failing
+		// disk too, so its output is what counts.
+		out, _ := cmd.Output()
+		if ctx.Err() != nil {
+			return disks, ctx.Err()
+		}
+
+		disk := parseSmartctl(string(out))
+		if disk.Health == "" {
+			continue
+		}
+		disk.Device = name
+		disks = append(disks, disk)
+	}
+
+	return disks, nil
+}
+
+// Parses the output of `smartctl -H -i -A', of ATA, NVMe or SCSI disks. The
+// health is empty when the output has no verdict, like when the disk doesn't
+// support SMART.
+func parseSmartctl(out string) SmartDisk {
+	var disk SmartDisk
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(line, ":")
+		if ok {
+			val = strings.TrimSpace(val)
+			switch strings.TrimSpace(key) {
+			case "Device Model", "Model Number", "Product":
+				disk.Model = val
+			case "SMART overall-health self-assessment test result", "SMART Health Status":
+				disk.Health = val
+				disk.Passed = val == "PASSED" || val == "OK"
+			case "Temperature", "Current Drive Temperature":
+				// like `35 Celsius' for NVMe, or `30 C' for SCSI
+				if fld := strings.Fields(val); len(fld) > 0 {
+					disk.Celsius, _ = strconv.Atoi(fld[0])
+				}
+			case "Elements in grown defect list":
+				disk.ReallocatedSectors, _ = strconv.ParseInt(val, 10, 64)
+			}
+			continue
+		}
+
+		// an ATA attribute, like
+		//   5 Reallocated_Sector_Ct 0x0033 100 100 010 Pre-fail Always - 0
+		// where the raw value may be followed by more details.
+		fld := strings.Fields(line)
+		if len(fld) < 10 {
+			continue
+		}
+		raw, err := strconv.ParseInt(fld[9], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fld[0] {
+		case "5":
+			disk.ReallocatedSectors = raw
+		case "197":
+			disk.PendingSectors = raw
+		case "194", "190":
+			// some disks pack the minimum and maximum into the raw value too,
+			// which makes it no temperature at all.
+			if raw < 150 && (fld[0] == "194" || disk.Celsius == 0) {
+				disk.Celsius = int(raw)
+			}
+		}
+	}
+
+	return disk
+}
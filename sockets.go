@@ -0,0 +1,215 @@
+package stats
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The socket tables in /proc/net, by protocol.
+var socketTables = []struct{ proto, file string }{
+	{"tcp", "/proc/net/tcp"},
+	{"tcp6", "/proc/net/tcp6"},
+	{"udp", "/proc/net/udp"},
+	{"udp6", "/proc/net/udp6"},
+}
+
+// The states of sockets in /proc/net which accept connections: TCP_LISTEN,
+// and TCP_CLOSE for unconnected UDP sockets.
+const (
+	tcpListen = "0A"
+	udpListen = "07"
+)
+
+// A socket on which a process listens for connections.
+type ListeningSocket struct {
+	// tcp, tcp6, udp or udp6
+	Proto   string `json:"proto"`
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	// The process owning the socket, empty when unknown. Only root can see
+	// the sockets of processes of other users.
+	PID     int    `json:"pid"`
+	Process string `json:"process"`
+	// Whether the port is not one of the allowed ports, when those are
+	// configured
+	Unexpected bool `json:"unexpected"`
+
+	inode string
+}
+
+// Returns a simple string representation of this struct.
+func (s ListeningSocket) String() string {
+	str := fmt.Sprintf("%s %s", s.Proto, net.JoinHostPort(s.Address, strconv.Itoa(s.Port)))
+	if s.Process != "" {
+		str += fmt.Sprintf(" (%s, %d)", s.Process, s.PID)
+	}
+
+	return str
+}
+
+// Gets the sockets listening for connections, from the socket tables in
+// /proc/net, sorted by protocol and port. The owning processes are found by
+// matching the inodes of the sockets with the open files of the processes.
+// Tables which don't exist, like tcp6 without IPv6 support, are skipped.
+func GetListeningSockets() ([]ListeningSocket, error) {
+	sockets := make([]ListeningSocket, 0)
+	for _, table := range socketTables {
+		content, err := ioutil.ReadFile(table.file)
+		if os.IsNotExist(err) && table.proto != "tcp" {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read `%s': %s", table.file, err)
+		}
+		sockets = append(sockets, parseSocketTable(table.proto, content)...)
+	}
+
+	owners := socketOwners()
+	for i := range sockets {
+		if pid, ok := owners[sockets[i].inode]; ok {
+			sockets[i].PID = pid
+			if comm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+				sockets[i].Process = strings.TrimSpace(string(comm))
+			}
+		}
+	}
+
+	sort.SliceStable(sockets, func(i, j int) bool {
+		if sockets[i].Proto != sockets[j].Proto {
+			return sockets[i].Proto < sockets[j].Proto
+		}
+		return sockets[i].Port < sockets[j].Port
+	})
+
+	return sockets, nil
+}
+
+// Parses a socket table from /proc/net, which looks like
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+//	0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 19624 ...
+//
+// and returns the listening sockets in it.
+func parseSocketTable(proto string, content []byte) []ListeningSocket {
+	listen := tcpListen
+	if strings.HasPrefix(proto, "udp") {
+		listen = udpListen
+	}
+
+	sockets := make([]ListeningSocket, 0)
+	// skip the first line, it's the header.
+	for _, line := range strings.Split(string(content), "\n")[1:] {
+		fld := strings.Fields(line)
+		if len(fld) < 10 || fld[3] != listen {
+			continue
+		}
+		// unconnected UDP sockets have no remote address.
+		if listen == udpListen && !strings.HasSuffix(fld[2], ":0000") {
+			continue
+		}
+
+		addr, port, ok := parseSocketAddress(fld[1])
+		if !ok {
+			continue
+		}
+		sockets = append(sockets, ListeningSocket{Proto: proto, Address: addr, Port: port, inode: fld[9]})
+	}
+
+	return sockets
+}
+
+// Parses an address in a socket table, like `0100007F:0035'. The IP address
+// is in hex, in host byte order per 32 bit word; the port is in hex.
+func parseSocketAddress(s string) (string, int, bool) {
+	hexIP, hexPort, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, false
+	}
+
+	ip, err := hex.DecodeString(hexIP)
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return "", 0, false
+	}
+	// the kernel prints the words as numbers, which hold the bytes in
+	// network order in memory.
+	for w := 0; w < len(ip); w += 4 {
+		binary.NativeEndian.PutUint32(ip[w:], binary.BigEndian.Uint32(ip[w:]))
+	}
+
+	port, err := strconv.ParseUint(hexPort, 16, 16)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return net.IP(ip).String(), int(port), true
+}
+
+// Returns the process IDs owning the sockets, by the inode of the socket. The
+// open files of processes which can't be read are skipped.
+func socketOwners() map[string]int {
+	owners := make(map[string]int)
+
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.Split(fd, "/")[2])
+		if err != nil {
+			continue
+		}
+		owners[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = pid
+	}
+
+	return owners
+}
+
+// Marks the sockets listening on a port which is not allowed as unexpected.
+// An allowed port is either a port number, like 22, or a protocol and a port
+// number, like udp/53, which allows the port for both IPv4 and IPv6. Sockets
+// on loopback addresses can't be reached from elsewhere, and are never
+// marked. Without any allowed ports, nothing is marked. Returns the amount of
+// unexpected sockets.
+func MarkUnexpectedPorts(sockets []ListeningSocket, allowed []string) int {
+	if len(allowed) == 0 {
+		return 0
+	}
+
+	count := 0
+	for i := range sockets {
+		if ip := net.ParseIP(sockets[i].Address); ip != nil && ip.IsLoopback() {
+			continue
+		}
+		if !isAllowedPort(sockets[i], allowed) {
+			sockets[i].Unexpected = true
+			count++
+		}
+	}
+
+	return count
+}
+
+// Returns whether the port of the socket is one of the allowed ports.
+func isAllowedPort(s ListeningSocket, allowed []string) bool {
+	port := strconv.Itoa(s.Port)
+	for _, a := range allowed {
+		proto, p, ok := strings.Cut(a, "/")
+		if !ok {
+			proto, p = "", a
+		}
+		if p == port && (proto == "" || strings.TrimSuffix(s.Proto, "6") == strings.ToLower(proto)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// State which is kept between runs, so a report can tell what changed since
+// the previous one. Stored as JSON in ~/.config/stats/state.
+type State struct {
+	// The external IP address last fetched from the providers, and when
+	ExtIp        string    `json:"ext_ip,omitempty"`
+	ExtIpFetched time.Time `json:"ext_ip_fetched,omitempty"`
+	// When the previous report was collected
+	Time time.Time `json:"time,omitempty"`
+	// The traffic counters of the network interfaces in the previous report
+	NetCounters map[string]NetCounters `json:"net_counters,omitempty"`
+	// The IP addresses of failed logins, and when they were last seen. Nil in
+	// state files of versions which didn't keep track of them yet.
+	FailedIps map[string]time.Time `json:"failed_ips"`
+	// When the watched processes started within the RespawnWindow, by name
+	ProcessStarts map[string][]time.Time `json:"process_starts,omitempty"`
+}
+
+// How long the IP address of a failed login is remembered after it was last
+// seen, when none is configured.
+const defaultFailedIpRetention = 7 * 24 * time.Hour
+
+// Returns whether the IP address of a failed login was seen within the
+// retention before now.
+func (s *State) SeenFailure(ip string, now time.Time, retention time.Duration) bool {
+	last, ok := s.FailedIps[ip]
+	return ok && now.Sub(last) < retention
+}
+
+// Returns the path of the state file belonging to the configuration file,
+// which is next to it. The state of ~/.config/stats/config is in
+// ~/.config/stats/state, other configuration files get a state file named
+// after them, so instances with different configurations don't mix up their
+// state.
+func StateFile(configFile string) string {
+	dir, name := path.Split(configFile)
+	if name == "config" {
+		return path.Join(dir, "state")
+	}
+
+	return path.Join(dir, strings.TrimSuffix(name, path.Ext(name))+".state")
+}
+
+// Loads the state from the given file. A missing file is not an error, since
+// there is no state before the first run; an empty state is returned instead.
+func LoadState(file string) (*State, error) {
+	state := &State{}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read state file `%s': %s", file, err)
+	}
+
+	if err = json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("Unable to parse state file `%s': %s", file, err)
+	}
+
+	return state, nil
+}
+
+// Updates the state with the data of the given report. Data which could not
+// be collected doesn't overwrite what was known before.
+func (s *State) Update(report *ReportData) {
+	s.UpdateExtIp(report)
+
+	s.Time = report.Time
+	s.NetCounters = make(map[string]NetCounters)
+	for _, iface := range report.Interfaces {
+		s.NetCounters[iface.Name] = iface.Counters
+	}
+
+	if s.FailedIps == nil {
+		s.FailedIps = make(map[string]time.Time)
+	}
+	if _, failed := report.Errors["authlog"]; !failed {
+		for _, f := range report.Failures {
+			s.FailedIps[f.IPAddress] = report.Time
+		}
+	}
+	// forget addresses which didn't return for a while, so the state file
+	// doesn't keep growing.
+	for ip, last := range s.FailedIps {
+		if report.Time.Sub(last) >= report.FailedIpRetention {
+			delete(s.FailedIps, ip)
+		}
+	}
+
+	// the starts are only those within the window already, processes which
+	// are no longer watched are forgotten.
+	if _, failed := report.Errors["processes"]; !failed {
+		s.ProcessStarts = make(map[string][]time.Time)
+		for _, r := range report.Respawns {
+			if len(r.Starts) > 0 {
+				s.ProcessStarts[r.Name] = r.Starts
+			}
+		}
+	}
+}
+
+// Returns a copy of what the collectors need of the state, which Update
+// doesn't change under them.
+func (s *State) snapshot() State {
+	snapshot := State{
+		ExtIp:         s.ExtIp,
+		ExtIpFetched:  s.ExtIpFetched,
+		Time:          s.Time,
+		NetCounters:   make(map[string]NetCounters, len(s.NetCounters)),
+		ProcessStarts: make(map[string][]time.Time, len(s.ProcessStarts)),
+	}
+	for name, counters := range s.NetCounters {
+		snapshot.NetCounters[name] = counters
+	}
+	for name, starts := range s.ProcessStarts {
+		snapshot.ProcessStarts[name] = append([]time.Time(nil), starts...)
+	}
+
+	return snapshot
+}
+
+// Remembers the external IP address of the report, when it was fetched
+// rather than reused from this state. An address which couldn't be fetched
+// doesn't overwrite the last known one.
+func (s *State) UpdateExtIp(report *ReportData) {
+	if report.ExtIp != "" && report.ExtIpFetched.After(s.ExtIpFetched) {
+		s.ExtIp = report.ExtIp
+		s.ExtIpFetched = report.ExtIpFetched
+	}
+}
+
+// Saves the state to the given file. The file is chmodded to 0600, just like
+// the configuration file.
+func (s *State) Save(file string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Unable to encode state: %s", err)
+	}
+
+	if err = os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Failed to create state directory `%s'", path.Dir(file))
+	}
+	if err = ioutil.WriteFile(file, content, 0600); err != nil {
+		return fmt.Errorf("Unable to write state file `%s': %s", file, err)
+	}
+	// WriteFile only sets the permissions when creating the file.
+	if err = os.Chmod(file, 0600); err != nil {
+		return fmt.Errorf("Failed to change permissions on state file `%s'", file)
+	}
+
+	return nil
+}
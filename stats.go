@@ -0,0 +1,1908 @@
+// Package stats collects statistics of a (Linux) server box, like its disk
+// usage, load, memory and the failed logins, and reports them by mail or
+// webhook. The collectors can be used on their own, or all at once through
+// CollectReport. The stats command in cmd/stats wires everything together.
+package stats
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/text/message"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Constants for reading the settings file.
+const (
+	SETTING_USERNAME     string = "UserName"
+	SETTING_PASSWORD     string = "Password"
+	SETTING_FROM_ADDR    string = "FromAddress"
+	SETTING_TO_ADDR      string = "ToAddress"
+	SETTING_MAIL_FROM    string = "MailFrom"
+	SETTING_MAIL_TO      string = "MailTo"
+	SETTING_MAIL_HOST    string = "MailHost"
+	SETTING_MAIL_SUBJECT string = "MailSubject"
+	SETTING_FAIL2BAN_LOG string = "Fail2banLog"
+	SETTING_JITTER       string = "StartupJitter"
+	SETTING_ONELINE      string = "OneLineFields"
+	SETTING_EXTIP_PROVS  string = "ExtIpProviders"
+	SETTING_IP_TIMEOUT   string = "ExtIpTimeout"
+	SETTING_DF_COMMAND   string = "DfCommand"
+	SETTING_DF_FLAGS     string = "DfFlags"
+	SETTING_DF_TIMEOUT   string = "DfTimeout"
+	SETTING_DISK_THRESH  string = "DiskUsageThreshold"
+	SETTING_ALERT_ONLY   string = "SendOnlyOnAlert"
+	SETTING_MAIL_SEC     string = "MailSecurity"
+	SETTING_MAIL_RETRIES string = "MailRetries"
+	SETTING_MAIL_DELAY   string = "MailRetryDelay"
+	SETTING_OUTPUT_FILE  string = "OutputFile"
+	SETTING_AUTH_LOG     string = "AuthLog"
+	SETTING_AUTH_UNITS   string = "AuthJournalUnits"
+	SETTING_AUTH_SINCE   string = "AuthJournalSince"
+	SETTING_AUTH_ROTATED string = "AuthLogRotated"
+	SETTING_AUTH_WINDOW  string = "AuthLogWindow"
+	SETTING_AUTH_PATTERN string = "AuthLogPattern"
+	SETTING_GEOIP_DB     string = "GeoIPDatabase"
+	SETTING_RESOLVE      string = "ResolveHostnames"
+	SETTING_PTR_TIMEOUT  string = "ResolveTimeout"
+	SETTING_IF_FILTER    string = "InterfaceFilter"
+	SETTING_TEMPLATE     string = "TemplatePath"
+	SETTING_TOP_PROCS    string = "TopProcessCount"
+	SETTING_TEMP_THRESH  string = "TempThreshold"
+	SETTING_INODE_THRESH string = "InodeThreshold"
+	SETTING_WEBHOOK_URL  string = "WebhookURL"
+	SETTING_WEBHOOK_FMT  string = "WebhookFormat"
+	SETTING_HOOK_TIMEOUT string = "WebhookTimeout"
+	SETTING_LOG_LEVEL    string = "LogLevel"
+	SETTING_COLL_TIMEOUT string = "CollectTimeout"
+	SETTING_REBOOT_LIMIT string = "RebootThreshold"
+	SETTING_IP_RETENTION string = "FailedIpRetention"
+	SETTING_DELIVERY     string = "DeliveryMethod"
+	SETTING_MAILDIR      string = "MaildirPath"
+	SETTING_SKIP_VERIFY  string = "MailInsecureSkipVerify"
+	SETTING_MAIL_CA_CERT string = "MailCACert"
+	SETTING_MAIL_AUTH    string = "MailAuthMethod"
+	SETTING_OAUTH_TOKEN  string = "MailOAuthToken"
+	SETTING_OAUTH_RTOKEN string = "MailOAuthRefreshToken"
+	SETTING_OAUTH_CLIENT string = "MailOAuthClientId"
+	SETTING_OAUTH_SECRET string = "MailOAuthClientSecret"
+	SETTING_OAUTH_URL    string = "MailOAuthTokenURL"
+	SETTING_CMD_TIMEOUT  string = "CommandTimeout"
+	SETTING_CMD_MAX_OUT  string = "CommandMaxOutput"
+	SETTING_PKG_MANAGER  string = "PackageManager"
+	SETTING_LOGIN_COUNT  string = "RecentLoginCount"
+	SETTING_KNOWN_HOSTS  string = "KnownHosts"
+	SETTING_LOCALE       string = "Locale"
+	SETTING_SWAP_THRESH  string = "SwapThreshold"
+	SETTING_DISK_INCLUDE string = "DiskIncludeMounts"
+	SETTING_DISK_EXCLUDE string = "DiskExcludeMounts"
+	SETTING_DISK_EXCL_FS string = "DiskExcludeFstypes"
+	SETTING_DISK_ALIASES string = "DiskMountAliases"
+	SETTING_IP_CACHE_TTL string = "ExtIpCacheTTL"
+	SETTING_WINDOW       string = "ReportWindow"
+	SETTING_ATTACH       string = "AttachReport"
+	SETTING_ALLOW_PORTS  string = "AllowedPorts"
+	SETTING_DISK_CRIT    string = "DiskCriticalThreshold"
+	SETTING_FAIL_WARN    string = "FailedLoginWarning"
+	SETTING_FAIL_CRIT    string = "FailedLoginCritical"
+	SETTING_ALERT_MIN    string = "AlertMinSeverity"
+	SETTING_MAIL_CC      string = "MailCc"
+	SETTING_MAIL_BCC     string = "MailBcc"
+	SETTING_HISTORY_DAYS string = "HistoryDays"
+	SETTING_HISTORY_MAX  string = "MaxHistoryEntries"
+	SETTING_HISTORY_AGE  string = "MaxHistoryAge"
+	SETTING_GAP_THRESH   string = "ReportGapThreshold"
+	SETTING_LOG_TAILS    string = "LogTails"
+	SETTING_CLOCK_OFFSET string = "ClockOffsetThreshold"
+	SETTING_MAIL_DIAL    string = "MailDialTimeout"
+	SETTING_MAIL_HELO    string = "MailHelo"
+	SETTING_AUTH_IGNORE  string = "AuthIgnoreIPs"
+	SETTING_DISKIO_ALL   string = "DiskIOAllDevices"
+	SETTING_SECTIONS_OFF string = "DisabledSections"
+	SETTING_SENDMAIL     string = "SendmailPath"
+	SETTING_RATE_WINDOW  string = "FailedLoginRateWindow"
+	SETTING_RATE_THRESH  string = "FailedLoginRateThreshold"
+	SETTING_WATCH_PROCS  string = "WatchedProcesses"
+	SETTING_RESPAWN_WIN  string = "RespawnWindow"
+	SETTING_RESPAWN_MAX  string = "RespawnThreshold"
+)
+
+// All the settings. Every setting can be overridden by an environment
+// variable, named after the setting by EnvVarName.
+var allSettings = []string{
+	SETTING_USERNAME,
+	SETTING_PASSWORD,
+	SETTING_FROM_ADDR,
+	SETTING_TO_ADDR,
+	SETTING_MAIL_FROM,
+	SETTING_MAIL_TO,
+	SETTING_MAIL_HOST,
+	SETTING_MAIL_SUBJECT,
+	SETTING_FAIL2BAN_LOG,
+	SETTING_JITTER,
+	SETTING_ONELINE,
+	SETTING_EXTIP_PROVS,
+	SETTING_IP_TIMEOUT,
+	SETTING_DF_COMMAND,
+	SETTING_DF_FLAGS,
+	SETTING_DF_TIMEOUT,
+	SETTING_DISK_THRESH,
+	SETTING_ALERT_ONLY,
+	SETTING_MAIL_SEC,
+	SETTING_MAIL_RETRIES,
+	SETTING_MAIL_DELAY,
+	SETTING_OUTPUT_FILE,
+	SETTING_AUTH_LOG,
+	SETTING_AUTH_UNITS,
+	SETTING_AUTH_SINCE,
+	SETTING_AUTH_ROTATED,
+	SETTING_AUTH_WINDOW,
+	SETTING_AUTH_PATTERN,
+	SETTING_GEOIP_DB,
+	SETTING_RESOLVE,
+	SETTING_PTR_TIMEOUT,
+	SETTING_IF_FILTER,
+	SETTING_TEMPLATE,
+	SETTING_TOP_PROCS,
+	SETTING_TEMP_THRESH,
+	SETTING_INODE_THRESH,
+	SETTING_WEBHOOK_URL,
+	SETTING_WEBHOOK_FMT,
+	SETTING_HOOK_TIMEOUT,
+	SETTING_LOG_LEVEL,
+	SETTING_COLL_TIMEOUT,
+	SETTING_REBOOT_LIMIT,
+	SETTING_IP_RETENTION,
+	SETTING_DELIVERY,
+	SETTING_MAILDIR,
+	SETTING_SKIP_VERIFY,
+	SETTING_MAIL_CA_CERT,
+	SETTING_MAIL_AUTH,
+	SETTING_OAUTH_TOKEN,
+	SETTING_OAUTH_RTOKEN,
+	SETTING_OAUTH_CLIENT,
+	SETTING_OAUTH_SECRET,
+	SETTING_OAUTH_URL,
+	SETTING_CMD_TIMEOUT,
+	SETTING_CMD_MAX_OUT,
+	SETTING_PKG_MANAGER,
+	SETTING_LOGIN_COUNT,
+	SETTING_KNOWN_HOSTS,
+	SETTING_LOCALE,
+	SETTING_SWAP_THRESH,
+	SETTING_DISK_INCLUDE,
+	SETTING_DISK_EXCLUDE,
+	SETTING_DISK_EXCL_FS,
+	SETTING_DISK_ALIASES,
+	SETTING_IP_CACHE_TTL,
+	SETTING_WINDOW,
+	SETTING_ATTACH,
+	SETTING_ALLOW_PORTS,
+	SETTING_DISK_CRIT,
+	SETTING_FAIL_WARN,
+	SETTING_FAIL_CRIT,
+	SETTING_ALERT_MIN,
+	SETTING_MAIL_CC,
+	SETTING_MAIL_BCC,
+	SETTING_HISTORY_DAYS,
+	SETTING_HISTORY_MAX,
+	SETTING_HISTORY_AGE,
+	SETTING_GAP_THRESH,
+	SETTING_LOG_TAILS,
+	SETTING_CLOCK_OFFSET,
+	SETTING_MAIL_DIAL,
+	SETTING_MAIL_HELO,
+	SETTING_AUTH_IGNORE,
+	SETTING_DISKIO_ALL,
+	SETTING_SECTIONS_OFF,
+	SETTING_SENDMAIL,
+	SETTING_RATE_WINDOW,
+	SETTING_RATE_THRESH,
+	SETTING_WATCH_PROCS,
+	SETTING_RESPAWN_WIN,
+	SETTING_RESPAWN_MAX,
+}
+
+// Defaults for retrying to send the mail.
+const (
+	defaultMailRetries    = 3
+	defaultMailRetryDelay = 30 * time.Second
+)
+
+// Time connecting to the mail host may take, when none is configured.
+const defaultMailDialTimeout = 30 * time.Second
+
+// Values for the MailSecurity setting.
+const (
+	MAIL_SECURITY_STARTTLS string = "starttls"
+	MAIL_SECURITY_TLS      string = "tls"
+	MAIL_SECURITY_NONE     string = "none"
+)
+
+// Values for the DeliveryMethod setting: send the mail to the MailHost, drop
+// it in the local Maildir at MaildirPath, or hand it to the local MTA through
+// the sendmail binary at SendmailPath.
+const (
+	DELIVERY_SMTP     string = "smtp"
+	DELIVERY_MAILDIR  string = "maildir"
+	DELIVERY_SENDMAIL string = "sendmail"
+)
+
+// Values for the AttachReport setting: attach nothing, the HTML report or the
+// report as JSON.
+const (
+	ATTACH_NONE string = "none"
+	ATTACH_HTML string = "html"
+	ATTACH_JSON string = "json"
+)
+
+// A file attached to the mail.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// Struct with mail settings.
+type MailSettings struct {
+	Username string `setting:"UserName"`
+	Password string `setting:"Password"`
+	// The From and To headers, which is what the recipient sees, like
+	// `Server report <stats@example.org>'
+	MailFrom    string `setting:"MailFrom"`
+	MailTo      string `setting:"MailTo"`
+	MailHost    string `setting:"MailHost"`
+	MailSubject string `setting:"MailSubject"`
+	// The envelope sender and recipient, the bare addresses the mail host
+	// delivers from and to, like `stats@example.org'. Bounces go to the
+	// FromAddress, and the Message-ID is in its domain.
+	FromAddress string        `setting:"FromAddress"`
+	ToAddress   string        `setting:"ToAddress"`
+	Security    string        `setting:"MailSecurity"`
+	Retries     int           `setting:"MailRetries"`
+	RetryDelay  time.Duration `setting:"MailRetryDelay"`
+	Body        string
+	TextBody    string
+	// Files attached next to the body, if any
+	Attachments []Attachment
+
+	// Comma separated lists of addresses which get a copy, like
+	// `Name <a@example.org>, b@example.org'. Only the Cc addresses show in
+	// the headers of the mail.
+	MailCc  string `setting:"MailCc"`
+	MailBcc string `setting:"MailBcc"`
+
+	// Time connecting to the mail host may take, zero for no limit
+	DialTimeout time.Duration `setting:"MailDialTimeout"`
+	// The name to greet the mail host with, the hostname when empty
+	Helo string `setting:"MailHelo"`
+
+	// PEM file with the certificate of a private CA to trust, next to the
+	// system's CAs
+	CACert string `setting:"MailCACert"`
+	// Don't verify the certificate of the mail host at all. Only for testing.
+	InsecureSkipVerify bool `setting:"MailInsecureSkipVerify"`
+
+	// How to authenticate, MAIL_AUTH_PLAIN with the password or
+	// MAIL_AUTH_XOAUTH2 with an OAuth token
+	AuthMethod string `setting:"MailAuthMethod"`
+	OAuth      OAuthSettings
+}
+
+// Tries to fetches the auth host based on the MailHost, which should
+// be in the format of `smtp.example.org:587'. The part before the port is
+// used as the auth host.
+func (ms *MailSettings) AuthHost() string {
+	splitup := strings.Split(ms.MailHost, ":")
+	if len(splitup) == 2 {
+		return splitup[0]
+	}
+
+	return ms.MailHost
+}
+
+// Returns the addresses the mail is sent to: the ToAddress, and the Cc and Bcc
+// addresses. Returns an error when the Cc or Bcc addresses can't be parsed.
+func (ms *MailSettings) Recipients() ([]string, error) {
+	recipients := []string{ms.ToAddress}
+	for _, list := range []string{ms.MailCc, ms.MailBcc} {
+		if strings.TrimSpace(list) == "" {
+			continue
+		}
+		addrs, err := mail.ParseAddressList(list)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address list `%s': %s", list, err)
+		}
+		for _, addr := range addrs {
+			recipients = append(recipients, addr.Address)
+		}
+	}
+
+	return recipients, nil
+}
+
+// Converts this struct to a string (debugging derp!)
+func (ms *MailSettings) String() string {
+	m := "Username=" + ms.Username + "\n"
+	m += "Password=" + REDACTED + "\n"
+	m += "MailFrom=" + ms.MailFrom + "\n"
+	m += "MailTo=" + ms.MailTo + "\n"
+	m += "MailHost=" + ms.MailHost + "\n"
+	m += "MailSubject=" + ms.MailSubject + "\n"
+	m += "FromAddress=" + ms.FromAddress + "\n"
+	m += "ToAddress=" + ms.ToAddress + "\n"
+	m += "MailCc=" + ms.MailCc + "\n"
+	m += "MailBcc=" + ms.MailBcc + "\n"
+	m += "Security=" + ms.Security + "\n"
+	m += "AuthMethod=" + ms.AuthMethod + "\n"
+	m += "Helo=" + ms.Helo + "\n"
+	m += fmt.Sprintf("Retries=%d, RetryDelay=%s, DialTimeout=%s\n", ms.Retries, ms.RetryDelay, ms.DialTimeout)
+	m += fmt.Sprintf("Body length=%d, TextBody length=%d", len(ms.Body), len(ms.TextBody))
+
+	return m
+}
+
+// Encodes this struct as JSON, with the password redacted.
+func (ms MailSettings) MarshalJSON() ([]byte, error) {
+	// the alias has no methods, or this would recurse.
+	type mailSettings MailSettings
+	plain := mailSettings(ms)
+	plain.Password = redact(plain.Password)
+
+	return json.Marshal(plain)
+}
+
+// Logs this struct like String does, so slog never logs the password.
+func (ms *MailSettings) LogValue() slog.Value {
+	return slog.StringValue(ms.String())
+}
+
+// What secrets are replaced with when printed, logged or encoded.
+const REDACTED = "<HIDDEN>"
+
+// The settings holding secrets.
+var secretSettings = map[string]bool{
+	SETTING_PASSWORD:     true,
+	SETTING_OAUTH_TOKEN:  true,
+	SETTING_OAUTH_RTOKEN: true,
+	SETTING_OAUTH_SECRET: true,
+}
+
+// Returns whether the setting holds a secret, like the password, which must
+// never be printed or logged.
+func IsSecretSetting(key string) bool {
+	return secretSettings[key]
+}
+
+// Returns a copy of the settings with the secrets redacted, which is safe to
+// print or log. Use this whenever the (merged) settings are shown.
+func RedactSettings(settings map[string]string) map[string]string {
+	redacted := make(map[string]string, len(settings))
+	for key, val := range settings {
+		if IsSecretSetting(key) {
+			val = redact(val)
+		}
+		redacted[key] = val
+	}
+
+	return redacted
+}
+
+// Returns REDACTED for secrets which are set, so it's still visible whether
+// they are.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return REDACTED
+}
+
+// FsEntry contains information about the mounted file systems.
+type FsEntry struct {
+	FileSystem    string `json:"file_system"`
+	Size          string `json:"size"`
+	Used          string `json:"used"`
+	Avail         string `json:"avail"`
+	UsePercentage string `json:"use_percentage"`
+	MountPoint    string `json:"mount_point"`
+	// The file system type, like ext4 or tmpfs, empty when unknown
+	Type string `json:"type"`
+	// The size, used and available space in bytes. When df reports human
+	// readable sizes, these are as precise as df's rounding.
+	SizeBytes  uint64 `json:"size_bytes"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	AvailBytes uint64 `json:"avail_bytes"`
+	// The disk and inode use percentages as numbers, -1 when unknown, like
+	// when df reports `-' for pseudo file systems
+	UsePercent  int `json:"use_percent"`
+	IUsePercent int `json:"iuse_percent"`
+	// Inode usage, empty when unknown
+	Inodes         string `json:"inodes"`
+	IUsed          string `json:"iused"`
+	IFree          string `json:"ifree"`
+	IUsePercentage string `json:"iuse_percentage"`
+}
+
+// A list of disk entries, sortable by use percentage, the fullest first.
+type FsEntries []FsEntry
+
+// Returns the length of this list.
+func (e FsEntries) Len() int {
+	return len(e)
+}
+
+// Swaps elements.
+func (e FsEntries) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+}
+
+// Returns whether an entry is fuller than the other one. Entries without a
+// known percentage sort last.
+func (e FsEntries) Less(i, j int) bool {
+	return e[i].UsePercent > e[j].UsePercent
+}
+
+// File system types which don't live on a disk, and don't count towards the
+// disk totals.
+var pseudoFstypes = []string{"tmpfs", "devtmpfs", "devfs", "overlay", "squashfs"}
+
+// Returns the total size and used space of the real file systems among the
+// entries. Pseudo file systems don't count, and a file system mounted more
+// than once (like with bind mounts) only counts once.
+func DiskTotals(entries []FsEntry) (size uint64, used uint64) {
+	seen := make(map[string]bool)
+	for _, fs := range entries {
+		if seen[fs.FileSystem] || matchesAny(pseudoFstypes, fs.Type) {
+			continue
+		}
+		seen[fs.FileSystem] = true
+		size += fs.SizeBytes
+		used += fs.UsedBytes
+	}
+
+	return size, used
+}
+
+// Formats the sizes in bytes the same way as every other amount of bytes in
+// the report, rather than in whatever format df used. Sizes which could not
+// be parsed are left alone.
+func (fs *FsEntry) formatSizes() {
+	if fs.SizeBytes == 0 && fs.Size != "0" {
+		return
+	}
+
+	fs.Size = formatBytes(fs.SizeBytes)
+	fs.Used = formatBytes(fs.UsedBytes)
+	fs.Avail = formatBytes(fs.AvailBytes)
+}
+
+// Parses the use percentages into their numeric counterparts.
+func (fs *FsEntry) parsePercentages() {
+	fs.UsePercent, fs.IUsePercent = -1, -1
+	if pct, ok := parseUsePercentage(fs.UsePercentage); ok {
+		fs.UsePercent = pct
+	}
+	if pct, ok := parseUsePercentage(fs.IUsePercentage); ok {
+		fs.IUsePercent = pct
+	}
+}
+
+// String rep.
+func (fs *FsEntry) String() string {
+	return fmt.Sprintf(
+		"%s, %s, %s, %s, %s, %s, %s inodes used",
+		fs.FileSystem,
+		fs.Size,
+		fs.Used,
+		fs.Avail,
+		fs.UsePercentage,
+		fs.MountPoint,
+		fs.IUsePercentage)
+}
+
+// The df binary and flags used when none are configured. The -h flag is
+// understood by both GNU and BSD df, unlike --si.
+var (
+	defaultDfCommand = "df"
+	defaultDfFlags   = []string{"-h"}
+)
+
+// Time df may take when none is configured. df hangs on a network mount whose
+// server is gone, like an unreachable NFS share.
+const defaultDfTimeout = 30 * time.Second
+
+// Gets the free disk space by doing a query using the `df' utility. Not
+// pure Go-ish, but still. Works wonders for the moment. The inode usage is
+// queried with a second run using the -i flag. When the df binary cannot be
+// found at all, this falls back to a statfs based implementation where the
+// platform supports it. Returns nil list and a non-nil error when an error
+// occurs (typically when the df command could not be invoked). df is killed
+// when the context is done.
+func GetFreeDiskSpace(ctx context.Context, dfCommand string, dfFlags []string) ([]FsEntry, error) {
+	cmd := exec.CommandContext(ctx, dfCommand, dfFlags...)
+	cmd.WaitDelay = killWaitDelay
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return statfsDiskSpace()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseDfOutput(out)
+	if err != nil {
+		return nil, err
+	}
+	types := mountTypes()
+	for i := range entries {
+		entries[i].formatSizes()
+		if entries[i].Type == "" {
+			entries[i].Type = types[entries[i].MountPoint]
+		}
+	}
+
+	// not every df supports -i in the same format (BSD adds the inode columns
+	// to the block columns), so the inode usage is a bonus.
+	inodeFlags := append(append([]string(nil), dfFlags...), "-i")
+	cmd = exec.CommandContext(ctx, dfCommand, inodeFlags...)
+	cmd.WaitDelay = killWaitDelay
+	if out, err := cmd.Output(); err == nil {
+		if inodes, err := parseDfOutput(out); err == nil {
+			mergeInodes(entries, inodes)
+		}
+	}
+	for i := range entries {
+		entries[i].parsePercentages()
+	}
+
+	return entries, nil
+}
+
+// Copies the inode usage into the entries with the same mount point, unless
+// they have it already. The inode entries are parsed df -i output, where the
+// size, used, available and percentage columns are the inode counts.
+func mergeInodes(entries []FsEntry, inodes []FsEntry) {
+	byMount := make(map[string]FsEntry, len(inodes))
+	for _, in := range inodes {
+		byMount[in.MountPoint] = in
+	}
+
+	for i := range entries {
+		// BSD df reports the inode usage next to the blocks already.
+		if entries[i].IUsePercentage != "" {
+			continue
+		}
+		if in, ok := byMount[entries[i].MountPoint]; ok {
+			entries[i].Inodes = in.Size
+			entries[i].IUsed = in.Used
+			entries[i].IFree = in.Avail
+			entries[i].IUsePercentage = in.UsePercentage
+		}
+	}
+}
+
+// Parses the output of df into a list of entries. The first line is expected
+// to be the header, which tells which columns there are: GNU df has the size,
+// used, available and percentage columns, BSD and macOS df add the inode
+// columns, and df -T adds the type. File system names and mount points may
+// contain spaces, the columns in between are recognized by their values.
+// Lines which don't fit the columns are skipped, as are file systems named
+// `none'. The sizes are parsed into bytes as well, see formatSizes.
+func parseDfOutput(out []byte) ([]FsEntry, error) {
+	lines := strings.Split(string(out), "\n")
+	if len(strings.TrimSpace(lines[0])) == 0 {
+		return nil, fmt.Errorf("No output from df")
+	}
+
+	// the columns between the file system and the mount point, which is
+	// named `Mounted on'.
+	header := strings.Fields(lines[0])
+	if len(header) > 1 && header[len(header)-2] == "Mounted" {
+		header = header[:len(header)-1]
+	}
+	if len(header) < 3 {
+		return nil, fmt.Errorf("Unexpected header of df: `%s'", strings.TrimSpace(lines[0]))
+	}
+	columns := header[1 : len(header)-1]
+
+	// the size column tells in which unit df reports, e.g. `1K-blocks' or
+	// `512-blocks'. Human readable sizes (`Size') carry their own unit.
+	blockSize := uint64(1)
+	for _, col := range columns {
+		if strings.HasSuffix(col, "-blocks") {
+			if bs, err := parseHumanBytes(strings.TrimSuffix(col, "-blocks")); err == nil && bs > 0 {
+				blockSize = bs
+			}
+		}
+	}
+
+	mpEntries := make([]FsEntry, 0)
+	// fields of the current entry. An entry may span two lines when the
+	// file system name is too long, and df wraps the rest onto the next line.
+	var fld []string
+	// skip the first line, it's the header anyway.
+	for _, line := range lines[1:] {
+		wrapped := len(fld) > 0
+		fld = append(fld, strings.Fields(line)...)
+		if len(fld) == 0 {
+			continue
+		}
+
+		start := dfValueColumns(fld, columns)
+		if start < 0 {
+			// only the file system name so far, the rest is on the next line.
+			if !wrapped && len(fld) == 1 {
+				continue
+			}
+			fld = nil
+			continue
+		}
+
+		fs := FsEntry{}
+		fs.FileSystem = strings.Join(fld[:start], " ")
+		fs.MountPoint = strings.Join(fld[start+len(columns):], " ")
+		for i, col := range columns {
+			val := fld[start+i]
+			switch {
+			case col == "Type":
+				fs.Type = val
+			case col == "Size" || col == "Inodes" || strings.HasSuffix(col, "-blocks"):
+				fs.Size = val
+			case col == "Used" || col == "IUsed":
+				fs.Used = val
+			case col == "Avail" || col == "Available" || col == "IFree":
+				fs.Avail = val
+			case col == "Use%" || col == "Capacity" || col == "IUse%":
+				fs.UsePercentage = val
+			case col == "iused":
+				fs.IUsed = val
+			case col == "ifree":
+				fs.IFree = val
+			case col == "%iused":
+				fs.IUsePercentage = val
+			}
+		}
+		fld = nil
+		if fs.FileSystem == "none" {
+			continue
+		}
+
+		size, err1 := parseHumanBytes(fs.Size)
+		used, err2 := parseHumanBytes(fs.Used)
+		avail, err3 := parseHumanBytes(fs.Avail)
+		if err1 == nil && err2 == nil && err3 == nil {
+			fs.SizeBytes = size * blockSize
+			fs.UsedBytes = used * blockSize
+			fs.AvailBytes = avail * blockSize
+		}
+
+		mpEntries = append(mpEntries, fs)
+	}
+
+	return mpEntries, nil
+}
+
+// Returns where the columns of df start within the fields of a line, after
+// the file system name, or -1 when the fields don't fit the columns. The
+// columns are numbers, sizes, percentages or `-', except for the type. Both
+// the file system name and the mount point take at least one field.
+func dfValueColumns(fld []string, columns []string) int {
+	for start := 1; start+len(columns) < len(fld); start++ {
+		fits := true
+		for i, col := range columns {
+			if col != "Type" && !isDfValue(fld[start+i]) {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return start
+		}
+	}
+
+	return -1
+}
+
+// Returns whether a field of df is a value, like `12G', `1024', `74%' or `-'.
+// macOS writes inode counts like `404k'.
+func isDfValue(val string) bool {
+	if val == "-" {
+		return true
+	}
+	if pct := strings.TrimSuffix(val, "%"); pct != val {
+		_, err := strconv.Atoi(pct)
+		return err == nil
+	}
+	if _, err := parseHumanBytes(val); err == nil {
+		return true
+	}
+	_, err := parseHumanBytes(strings.ToUpper(val))
+
+	return err == nil
+}
+
+// Disk and inode usage percentages over which a mount is reported as an
+// alert, when none are configured.
+const (
+	defaultDiskThreshold  = 90
+	defaultInodeThreshold = 90
+)
+
+// Swap usage percentage over which the swap is reported as an alert, when
+// none is configured. Heavy swapping often precedes running out of memory.
+const defaultSwapThreshold = 80
+
+// Parses a use percentage as reported by df, like `74%', into an integer.
+// Returns false when there is no percentage, which is the case for some
+// pseudo file systems reporting `-'.
+func parseUsePercentage(pct string) (int, bool) {
+	val, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(pct), "%"))
+	if err != nil {
+		return 0, false
+	}
+
+	return val, true
+}
+
+// Returns the entries which have a use percentage over the given threshold,
+// or an inode use percentage over the given inode threshold.
+func DiskAlerts(entries []FsEntry, threshold int, inodeThreshold int) []FsEntry {
+	alerts := make([]FsEntry, 0)
+	for _, fs := range entries {
+		if fs.UsePercent > threshold || fs.IUsePercent > inodeThreshold {
+			alerts = append(alerts, fs)
+		}
+	}
+
+	return alerts
+}
+
+// Calculates the usage percentage the way df does: used space relative to
+// the space available to normal users, rounded up. Formatted like `74%'.
+func usePercentage(used, avail uint64) string {
+	total := used + avail
+	if total == 0 {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d%%", (used*100+total-1)/total)
+}
+
+// Gets the free disk space using the df binary, flags and timeout of the
+// configuration. The entries are filtered and the mount points renamed as
+// configured, see FilterDiskEntries and AliasMountPoints.
+func GetFreeDiskSpaceFromConfig(ctx context.Context, cfg Config) ([]FsEntry, error) {
+	dfCtx, cancel := context.WithTimeout(ctx, cfg.DfTimeout)
+	defer cancel()
+
+	entries, err := GetFreeDiskSpace(dfCtx, cfg.DfCommand, strings.Fields(cfg.DfFlags))
+	if dfCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("`%s' did not finish within %s, a network mount may be unreachable", cfg.DfCommand, cfg.DfTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries = FilterDiskEntries(entries, cfg.DiskInclude, cfg.DiskExclude, cfg.DiskExcludeFs)
+	AliasMountPoints(entries, cfg.DiskAliases)
+
+	return entries, nil
+}
+
+// Filters the disk entries. When there are include patterns, only the mount
+// points matching one of them are kept, like / or /home. Mount points matching
+// an exclude pattern are dropped, and so is everything mounted below them:
+// /var/lib/docker drops every overlay in there, /snap/* every snap. Entries
+// with a file system type matching one of the fstype patterns, like squashfs
+// or fuse.*, are dropped too. The patterns are globs as in path.Match.
+// Without any patterns, everything is kept.
+func FilterDiskEntries(entries []FsEntry, include, exclude, fstypes []string) []FsEntry {
+	if len(include) == 0 && len(exclude) == 0 && len(fstypes) == 0 {
+		return entries
+	}
+
+	filtered := make([]FsEntry, 0, len(entries))
+	for _, fs := range entries {
+		if len(include) > 0 && !matchesAny(include, fs.MountPoint) {
+			continue
+		}
+		if fs.Type != "" && matchesAny(fstypes, fs.Type) {
+			continue
+		}
+
+		excluded := false
+		for dir := fs.MountPoint; !excluded; dir = path.Dir(dir) {
+			excluded = matchesAny(exclude, dir)
+			if dir == "/" || dir == "." {
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, fs)
+		}
+	}
+
+	return filtered
+}
+
+// Returns whether the name matches one of the glob patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Renames the mount points to friendlier labels. The aliases are like
+// `/mnt/d1=Photos', mapping a mount point to its label.
+func AliasMountPoints(entries []FsEntry, aliases []string) {
+	labels := make(map[string]string, len(aliases))
+	for _, alias := range aliases {
+		if mount, label, ok := strings.Cut(alias, "="); ok {
+			labels[strings.TrimSpace(mount)] = strings.TrimSpace(label)
+		}
+	}
+
+	for i := range entries {
+		if label, ok := labels[entries[i].MountPoint]; ok {
+			entries[i].MountPoint = label
+		}
+	}
+}
+
+// Parses the response body of an external IP provider into an IP address.
+type ipParser func(body []byte) (string, error)
+
+// Parses a JSON response containing an `ip' field, like jsonip.com does.
+func parseJsonIP(body []byte) (string, error) {
+	type JsonIP struct {
+		Ip    string `json:"ip"`
+		About string `json:"about"`
+	}
+
+	jip := JsonIP{}
+	if err := json.Unmarshal(body, &jip); err != nil {
+		return "", err
+	}
+
+	return jip.Ip, nil
+}
+
+// Parses a plain text response which contains nothing but the IP address,
+// like ifconfig.me and api.ipify.org do.
+func parsePlainIP(body []byte) (string, error) {
+	return strings.TrimSpace(string(body)), nil
+}
+
+// Parsers for the known external IP providers.
+var extIPParsers = map[string]ipParser{
+	"http://jsonip.com":                 parseJsonIP,
+	"https://api.ipify.org":             parsePlainIP,
+	"https://api.ipify.org?format=json": parseJsonIP,
+	"https://ifconfig.me/ip":            parsePlainIP,
+	"https://icanhazip.com":             parsePlainIP,
+}
+
+// Timeout per external IP provider when none is configured.
+const defaultExtIPTimeout = 10 * time.Second
+
+// How long a fetched external IP address is reused before asking the
+// providers again, when none is configured. Keeps frequent runs from getting
+// rate limited.
+const defaultExtIPCacheTTL = 5 * time.Minute
+
+// The providers which are tried when none are configured.
+var defaultExtIPProviders = []string{
+	"http://jsonip.com",
+	"https://api.ipify.org",
+	"https://ifconfig.me/ip",
+}
+
+// Returns the parser for the given provider URL. Unknown providers get a
+// parser based on the response: JSON when it looks like an object, plain
+// text otherwise.
+func parserFor(provider string) ipParser {
+	if parser, ok := extIPParsers[provider]; ok {
+		return parser
+	}
+
+	return func(body []byte) (string, error) {
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+			return parseJsonIP(body)
+		}
+		return parsePlainIP(body)
+	}
+}
+
+// Fetches the external IP address from a single provider. The body is only
+// closed once the request succeeded, since resp is nil on errors.
+func fetchExtIPAddress(ctx context.Context, client *http.Client, provider string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	// defer closing of the body
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unexpected HTTP status `%s'", resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	ip, err := parserFor(provider)(body)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("Response `%s' is not a valid IP address", ip)
+	}
+
+	return ip, nil
+}
+
+// Gets the external WAN address of the gateway of this box. Interesting
+// to see whether the IP changed all of a sudden. The providers are tried in
+// order, and the first valid IP address is returned. When all of them fail,
+// the returned error lists what went wrong for every provider. The timeout
+// applies per provider, so a hung connection can't block the whole report.
+// Canceling the context aborts the current request, and skips the remaining
+// providers.
+func GetExtIPAddress(ctx context.Context, providers []string, timeout time.Duration) (string, error) {
+	client := &http.Client{Timeout: timeout}
+
+	errs := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		ip, err := fetchExtIPAddress(ctx, client, provider)
+		if err == nil {
+			return ip, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", provider, err))
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("No external IP providers configured")
+	}
+
+	return "", fmt.Errorf("All external IP providers failed: %s", strings.Join(errs, "; "))
+}
+
+// Gets the external WAN address using the providers and timeout of the
+// configuration.
+func GetExtIPAddressFromConfig(ctx context.Context, cfg Config) (string, error) {
+	return GetExtIPAddress(ctx, cfg.ExtIpProviders, cfg.ExtIpTimeout)
+}
+
+// Uptime under which the box is reported as recently rebooted, when none is
+// configured.
+const defaultRebootThreshold = 10 * time.Minute
+
+// Load averages and process counts as reported by /proc/loadavg.
+type LoadAverage struct {
+	// Load averages over the last 1, 5 and 15 minutes
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+	// Amount of currently runnable processes
+	Running int `json:"running"`
+	// Total amount of processes, zero when unknown, like on the BSDs
+	Total int `json:"total"`
+}
+
+// Returns a simple string representation of this struct.
+func (l LoadAverage) String() string {
+	if l.Total == 0 {
+		return fmt.Sprintf("%.2f %.2f %.2f", l.Load1, l.Load5, l.Load15)
+	}
+	return fmt.Sprintf("%.2f %.2f %.2f (%d/%d)", l.Load1, l.Load5, l.Load15, l.Running, l.Total)
+}
+
+// Memory usage as reported by /proc/meminfo. All values are in bytes.
+type MemoryInfo struct {
+	Total     uint64 `json:"total"`
+	Free      uint64 `json:"free"`
+	Available uint64 `json:"available"`
+	Buffers   uint64 `json:"buffers"`
+	Cached    uint64 `json:"cached"`
+	SwapTotal uint64 `json:"swap_total"`
+	SwapFree  uint64 `json:"swap_free"`
+	// The swap devices from /proc/swaps, empty without swap
+	Swaps []SwapDevice `json:"swaps"`
+}
+
+// Returns the amount of memory in use, which is everything that's not
+// available for starting new applications.
+func (m MemoryInfo) Used() uint64 {
+	if m.Available > m.Total {
+		return 0
+	}
+	return m.Total - m.Available
+}
+
+// Returns the percentage of memory in use.
+func (m MemoryInfo) UsedPercentage() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+	return float64(m.Used()) / float64(m.Total) * 100
+}
+
+// Returns the amount of swap in use.
+func (m MemoryInfo) SwapUsed() uint64 {
+	if m.SwapFree > m.SwapTotal {
+		return 0
+	}
+	return m.SwapTotal - m.SwapFree
+}
+
+// Returns the percentage of swap in use, or zero when there is no swap.
+func (m MemoryInfo) SwapUsedPercentage() float64 {
+	if m.SwapTotal == 0 {
+		return 0
+	}
+	return float64(m.SwapUsed()) / float64(m.SwapTotal) * 100
+}
+
+// A swap device or file, as listed in /proc/swaps. Sizes are in bytes.
+type SwapDevice struct {
+	Name string `json:"name"`
+	// partition or file
+	Type     string `json:"type"`
+	Size     uint64 `json:"size"`
+	Used     uint64 `json:"used"`
+	Priority int    `json:"priority"`
+	// Whether the device is compressed RAM rather than a disk
+	IsZram bool `json:"is_zram"`
+}
+
+// Returns the percentage of this swap device in use.
+func (s SwapDevice) UsedPercentage() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	return float64(s.Used) / float64(s.Size) * 100
+}
+
+// Gets the swap devices from /proc/swaps, which lists them like
+// `/dev/zram0  partition  1048572  5120  100' below a header. The sizes are
+// in KiB.
+func GetSwaps() ([]SwapDevice, error) {
+	content, err := ioutil.ReadFile("/proc/swaps")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read /proc/swaps: %s", err)
+	}
+
+	swaps := make([]SwapDevice, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		fld := strings.Fields(line)
+		if len(fld) != 5 || fld[0] == "Filename" {
+			continue
+		}
+
+		size, err := strconv.ParseUint(fld[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		used, _ := strconv.ParseUint(fld[3], 10, 64)
+		prio, _ := strconv.Atoi(fld[4])
+
+		swaps = append(swaps, SwapDevice{
+			Name:     fld[0],
+			Type:     fld[1],
+			Size:     size * 1024,
+			Used:     used * 1024,
+			Priority: prio,
+			IsZram:   strings.HasPrefix(fld[0], "/dev/zram"),
+		})
+	}
+
+	return swaps, nil
+}
+
+// Formats the given amount of bytes using IEC units (KiB, MiB, ...) with one
+// decimal, like `3.2 GiB'. Amounts below 1 KiB are formatted as plain bytes.
+func formatBytes(n uint64) string {
+	return formatBytesWith(n, fmt.Sprintf)
+}
+
+// Formats a byte count like formatBytes, with the given Sprintf, like the
+// one of a message.Printer to use its decimal separator.
+func formatBytesWith(n uint64, sprintf func(format string, a ...interface{}) string) string {
+	const unit = 1024
+	if n < unit {
+		return sprintf("%d B", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Parses an amount of bytes as printed by df -h, like `13G', `3.0G', `450M'
+// or `0'. The units are powers of 1024, with an optional `i' and `B' (as in
+// `12Gi' from BSD df, or `12GB'). A plain number is an amount of bytes.
+func parseHumanBytes(s string) (uint64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(s), "B"), "i")
+	// macOS writes bytes as `Bi', like `0Bi'.
+	num = strings.TrimSuffix(num, "B")
+
+	multiplier := uint64(1)
+	if num != "" {
+		if exp := strings.IndexByte("KMGTPE", num[len(num)-1]); exp >= 0 {
+			num = num[:len(num)-1]
+			for i := 0; i <= exp; i++ {
+				multiplier *= 1024
+			}
+		}
+	}
+
+	val, err := strconv.ParseFloat(num, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("Invalid size `%s'", s)
+	}
+
+	return uint64(val * float64(multiplier)), nil
+}
+
+// Formats the given duration as more readable string, like `2 days, 1 hour
+// and 12 seconds'. Units which are zero are left out, and durations shorter
+// than a second are `less than a second'.
+func FormatDuration(dur time.Duration) string {
+	return FormatDurationLocale(dur, englishPrinter)
+}
+
+// Formats the given duration like FormatDuration, in the language of the
+// printer, see NewPrinter.
+func FormatDurationLocale(dur time.Duration, p *message.Printer) string {
+	units := []struct {
+		amount int
+		key    string
+	}{
+		{int(dur.Hours() / 24), "%d days"},
+		{int(dur.Hours()) % 24, "%d hours"},
+		{int(dur.Minutes()) % 60, "%d minutes"},
+		{int(dur.Seconds()) % 60, "%d seconds"},
+	}
+
+	parts := make([]string, 0, len(units))
+	for _, unit := range units {
+		if unit.amount != 0 {
+			parts = append(parts, p.Sprintf(unit.key, unit.amount))
+		}
+	}
+
+	switch len(parts) {
+	case 0:
+		return p.Sprintf("less than a second")
+	case 1:
+		return parts[0]
+	}
+
+	return strings.Join(parts[:len(parts)-1], ", ") + " " + p.Sprintf("and") + " " + parts[len(parts)-1]
+}
+
+// Information about a network interface.
+type InterfaceInfo struct {
+	Name         string    `json:"name"`
+	HardwareAddr string    `json:"hardware_addr"`
+	Flags        net.Flags `json:"flags"`
+	// The addresses of this interface, in CIDR notation
+	Addresses []string `json:"addresses"`
+	// The traffic counters, as read from /proc/net/dev
+	Counters NetCounters `json:"counters"`
+	// Whether the traffic since the previous report is known, i.e. the
+	// counters of the previous report are known
+	HasTraffic bool `json:"has_traffic"`
+	// Bytes received and sent since the previous report
+	RxDelta uint64 `json:"rx_delta"`
+	TxDelta uint64 `json:"tx_delta"`
+	// Average bytes per second received and sent since the previous report
+	RxRate float64 `json:"rx_rate"`
+	TxRate float64 `json:"tx_rate"`
+}
+
+// The byte counters of a network interface.
+type NetCounters struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+// Returns whether the interface is up.
+func (i InterfaceInfo) IsUp() bool {
+	return i.Flags&net.FlagUp != 0
+}
+
+// Returns whether the interface is a loopback interface.
+func (i InterfaceInfo) IsLoopback() bool {
+	return i.Flags&net.FlagLoopback != 0
+}
+
+// Returns a simple string representation of this struct.
+func (i InterfaceInfo) String() string {
+	return fmt.Sprintf("%s (%s): %s", i.Name, i.Flags, strings.Join(i.Addresses, ", "))
+}
+
+// Fetches the network interfaces, with their addresses and flags.
+func GetInterfaces(ctx context.Context) ([]InterfaceInfo, error) {
+	if ctx.Err() != nil {
+		return make([]InterfaceInfo, 0), ctx.Err()
+	}
+
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return make([]InterfaceInfo, 0), err
+	}
+
+	infos := make([]InterfaceInfo, 0, len(ifs))
+
+	for _, iface := range ifs {
+		info := InterfaceInfo{
+			Name:         iface.Name,
+			HardwareAddr: iface.HardwareAddr.String(),
+			Flags:        iface.Flags,
+			Addresses:    make([]string, 0),
+		}
+
+		addresses, _ := iface.Addrs()
+		for _, addr := range addresses {
+			info.Addresses = append(info.Addresses, addr.String())
+		}
+
+		infos = append(infos, info)
+	}
+
+	// the counters are a bonus, they're not available everywhere.
+	if counters, err := GetNetCounters(); err == nil {
+		for i := range infos {
+			infos[i].Counters = counters[infos[i].Name]
+		}
+	}
+
+	return infos, nil
+}
+
+// Gets the byte counters of all network interfaces from /proc/net/dev, mapped
+// by interface name.
+func GetNetCounters() (map[string]NetCounters, error) {
+	content, err := ioutil.ReadFile("/proc/net/dev")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read `/proc/net/dev': %s", err)
+	}
+
+	return parseNetDev(content), nil
+}
+
+// Parses the contents of /proc/net/dev. After two header lines, every line
+// looks like this, with eight receive and eight transmit columns:
+//
+//	eth0: 1234567 8901 0 0 0 0 0 0 7654321 1098 0 0 0 0 0 0
+func parseNetDev(content []byte) map[string]NetCounters {
+	counters := make(map[string]NetCounters)
+
+	for _, line := range strings.Split(string(content), "\n") {
+		nameAndStats := strings.SplitN(line, ":", 2)
+		if len(nameAndStats) != 2 {
+			continue
+		}
+		fld := strings.Fields(nameAndStats[1])
+		if len(fld) < 16 {
+			continue
+		}
+
+		rx, err1 := strconv.ParseUint(fld[0], 10, 64)
+		tx, err2 := strconv.ParseUint(fld[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		counters[strings.TrimSpace(nameAndStats[0])] = NetCounters{rx, tx}
+	}
+
+	return counters
+}
+
+// Calculates the traffic of each interface since the previous report, using
+// the counters of that report and the time which elapsed since then. A counter
+// which is lower than before has been reset, most likely by a reboot, so then
+// the current value is all we know about.
+func ApplyNetDeltas(infos []InterfaceInfo, previous map[string]NetCounters, elapsed time.Duration) {
+	for i := range infos {
+		prev, ok := previous[infos[i].Name]
+		if !ok || elapsed <= 0 {
+			continue
+		}
+
+		infos[i].HasTraffic = true
+		infos[i].RxDelta = counterDelta(infos[i].Counters.RxBytes, prev.RxBytes)
+		infos[i].TxDelta = counterDelta(infos[i].Counters.TxBytes, prev.TxBytes)
+		infos[i].RxRate = float64(infos[i].RxDelta) / elapsed.Seconds()
+		infos[i].TxRate = float64(infos[i].TxDelta) / elapsed.Seconds()
+	}
+}
+
+// Returns the difference between the current and previous value of a counter,
+// or the current value when the counter has been reset in the meantime.
+func counterDelta(current, previous uint64) uint64 {
+	if current < previous {
+		return current
+	}
+
+	return current - previous
+}
+
+// Filters the interfaces using the given filter, which is either `all' to
+// keep everything, `up' to keep the interfaces which are up and are not a
+// loopback interface, or a list of glob patterns (like eth*) matching the
+// names of the interfaces to keep. An empty filter keeps everything.
+func FilterInterfaces(infos []InterfaceInfo, filter []string) []InterfaceInfo {
+	if len(filter) == 0 || (len(filter) == 1 && filter[0] == "all") {
+		return infos
+	}
+
+	filtered := make([]InterfaceInfo, 0, len(infos))
+	for _, info := range infos {
+		if len(filter) == 1 && filter[0] == "up" {
+			if info.IsUp() && !info.IsLoopback() {
+				filtered = append(filtered, info)
+			}
+			continue
+		}
+
+		for _, pattern := range filter {
+			if ok, _ := path.Match(pattern, info.Name); ok {
+				filtered = append(filtered, info)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+// Builds the complete message, headers and body, from the mail settings. When
+// there is a plain text body, the message is a multipart/alternative message
+// with both the plain text and the HTML body, so every mail client can show
+// it. Otherwise it's just the HTML body. With attachments, that's wrapped in
+// a multipart/mixed message, followed by the attachments.
+func BuildMessage(ms *MailSettings) []byte {
+	message := bytes.Buffer{}
+	// spam filters frown upon mail without a date or a message ID.
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: %s\r\n", messageID(ms.FromAddress))
+	fmt.Fprintf(&message, "From: %s\r\n", ms.MailFrom)
+	fmt.Fprintf(&message, "To: %s\r\n", ms.MailTo)
+	// the Bcc addresses are only in the envelope, see Recipients.
+	if ms.MailCc != "" {
+		fmt.Fprintf(&message, "Cc: %s\r\n", ms.MailCc)
+	}
+	// non-ASCII subjects need to be encoded, plain ones are left alone.
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", ms.MailSubject))
+
+	// the bodies are quoted-printable, so they survive mail hosts which
+	// don't cope with 8 bit data or long lines.
+	header := textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+	body := quotedPrintable(ms.Body)
+	if ms.TextBody != "" {
+		parts := bytes.Buffer{}
+		mpw := multipart.NewWriter(&parts)
+		// the preferred alternative goes last.
+		for _, alt := range []struct{ contentType, body string }{
+			{"text/plain; charset=UTF-8", ms.TextBody},
+			{"text/html; charset=UTF-8", ms.Body},
+		} {
+			w, _ := mpw.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {alt.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			w.Write(quotedPrintable(alt.body))
+		}
+		mpw.Close()
+		header, body = textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + mpw.Boundary()}}, parts.Bytes()
+	}
+
+	if len(ms.Attachments) > 0 {
+		header, body = attachTo(header, body, ms.Attachments)
+	}
+
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: %s\r\n", header.Get("Content-Type"))
+	if encoding := header.Get("Content-Transfer-Encoding"); encoding != "" {
+		fmt.Fprintf(&message, "Content-Transfer-Encoding: %s\r\n", encoding)
+	}
+	message.WriteString("\r\n")
+	message.Write(body)
+
+	return message.Bytes()
+}
+
+// Encodes the body as quoted-printable, with CRLF line endings.
+func quotedPrintable(body string) []byte {
+	encoded := bytes.Buffer{}
+	w := quotedprintable.NewWriter(&encoded)
+	io.WriteString(w, body)
+	w.Close()
+
+	return encoded.Bytes()
+}
+
+// Returns a new, unique message ID in the domain of the given address, like
+// `<1718000000.5f2b9c0e8a1d3f47@example.org>'. Without a domain in the address,
+// the hostname is used.
+func messageID(address string) string {
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok || domain == "" {
+		domain, _ = os.Hostname()
+	}
+
+	return fmt.Sprintf("<%d.%016x@%s>", time.Now().Unix(), rand.Uint64(), strings.Trim(domain, "<> "))
+}
+
+// Wraps the body, with the given header, in a multipart/mixed body, followed
+// by the attachments, which are base64 encoded. Returns the header and the
+// new body.
+func attachTo(header textproto.MIMEHeader, body []byte, attachments []Attachment) (textproto.MIMEHeader, []byte) {
+	parts := bytes.Buffer{}
+	mpw := multipart.NewWriter(&parts)
+
+	w, _ := mpw.CreatePart(header)
+	w.Write(body)
+
+	for _, a := range attachments {
+		w, _ = mpw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		// lines of encoded data may not exceed 76 characters.
+		encoded := base64.StdEncoding.EncodeToString(a.Content)
+		for len(encoded) > 76 {
+			io.WriteString(w, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(w, encoded+"\r\n")
+	}
+	mpw.Close()
+
+	return textproto.MIMEHeader{"Content-Type": {"multipart/mixed; boundary=" + mpw.Boundary()}}, parts.Bytes()
+}
+
+// Actually sends the mail using the mail settings struct. Transient failures
+// are retried up to ms.Retries times, doubling the delay between attempts.
+// Permanent failures (5xx replies) are not retried. Returns an error when the
+// mail could not be delivered to the mail host.
+func SendMail(ms *MailSettings) error {
+	message := BuildMessage(ms)
+
+	recipients, err := ms.Recipients()
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Sending mail", "host", ms.MailHost, "security", ms.Security, "to", recipients)
+
+	delay := ms.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := sendSMTP(ms, recipients, message)
+		if err == nil {
+			return nil
+		}
+		if isPermanentSMTPError(err) || attempt > ms.Retries {
+			return err
+		}
+
+		slog.Warn("Failed to send mail, retrying", "attempt", attempt, "attempts", ms.Retries+1, "error", err, "delay", delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Returns whether the error is a permanent SMTP failure, i.e. a 5xx reply
+// from the server. Retrying those is pointless, unlike 4xx replies and
+// network errors which may well be transient.
+func isPermanentSMTPError(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500 && protoErr.Code < 600
+	}
+
+	return false
+}
+
+// Connects to the mail host using the configured security: implicit TLS
+// (SMTPS, usually port 465), STARTTLS (usually port 587) or none at all.
+// With STARTTLS, an error is returned when the server doesn't support it,
+// rather than silently continuing in the clear. Connecting is bounded by the
+// DialTimeout, and the mail host is greeted with the Helo name.
+func dialSMTP(ms *MailSettings) (*smtp.Client, error) {
+	tlsConfig, err := ms.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: ms.DialTimeout}
+
+	switch ms.Security {
+	case MAIL_SECURITY_TLS:
+		conn, err := tls.DialWithDialer(dialer, "tcp", ms.MailHost, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return newSMTPClient(conn, ms)
+	case MAIL_SECURITY_STARTTLS, MAIL_SECURITY_NONE:
+		conn, err := dialer.Dial("tcp", ms.MailHost)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newSMTPClient(conn, ms)
+		if err != nil {
+			return nil, err
+		}
+		if ms.Security == MAIL_SECURITY_NONE {
+			return c, nil
+		}
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, fmt.Errorf("Mail host `%s' does not support STARTTLS", ms.MailHost)
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("Unknown mail security `%s', expected one of %s, %s or %s",
+		ms.Security, MAIL_SECURITY_STARTTLS, MAIL_SECURITY_TLS, MAIL_SECURITY_NONE)
+}
+
+// Starts an SMTP session on the connection, and greets the mail host. The
+// connection is closed when that fails. Without a Helo name, the hostname is
+// used, since some mail hosts reject the `localhost' net/smtp would send.
+func newSMTPClient(conn net.Conn, ms *MailSettings) (*smtp.Client, error) {
+	c, err := smtp.NewClient(conn, ms.AuthHost())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	helo := ms.Helo
+	if helo == "" {
+		helo, _ = os.Hostname()
+	}
+	if helo != "" {
+		if err = c.Hello(helo); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("Mail host `%s' rejected HELO %s: %s", ms.MailHost, helo, err)
+		}
+	}
+
+	return c, nil
+}
+
+// Returns the TLS configuration to connect to the mail host with. The
+// certificate of the mail host is verified against the system's CAs and the
+// CACert, unless verification is explicitly disabled.
+func (ms *MailSettings) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: ms.AuthHost()}
+
+	if ms.CACert != "" {
+		pem, err := ioutil.ReadFile(ms.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read CA certificate `%s': %s", ms.CACert, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in `%s'", ms.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if ms.InsecureSkipVerify {
+		slog.Warn("Not verifying the certificate of the mail host", "host", ms.MailHost)
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
+
+// Connects and authenticates to the mail host like SendMail does, but quits
+// without sending anything. Returns an error when either fails.
+func VerifySMTP(ms *MailSettings) error {
+	c, err := dialSMTP(ms)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ms.Username != "" {
+		auth, err := ms.Auth()
+		if err != nil {
+			return err
+		}
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	return c.Quit()
+}
+
+// Sends the message to the given recipients over a connection set up by
+// dialSMTP. Authentication is skipped when no username is configured.
+func sendSMTP(ms *MailSettings, recipients []string, message []byte) error {
+	c, err := dialSMTP(ms)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ms.Username != "" {
+		auth, err := ms.Auth()
+		if err != nil {
+			return err
+		}
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(ms.FromAddress); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err = c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(message); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// Returns the directory holding the configuration and state files, which is
+// ~/.config/stats of the current user.
+func ConfigDir() (string, error) {
+	// get the current user, so we can get the home dir.
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("Cannot fetch current user")
+	}
+
+	return path.Join(u.HomeDir, ".config", "stats"), nil
+}
+
+// Environment variable with the path of the configuration file.
+const ENV_CONFIG = "STATS_CONFIG"
+
+// Returns the path of the configuration file: the given override when it's
+// not empty, else the one in the STATS_CONFIG environment variable, else
+// ~/.config/stats/config.
+func ConfigFile(override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if env := os.Getenv(ENV_CONFIG); env != "" {
+		return env, nil
+	}
+
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(dir, "config"), nil
+}
+
+// Prepares configuration by reading the given config file, see ConfigFile.
+// The file is ini, or TOML or YAML by its extension, see ConfigFormat.
+// If the file does not exist, create it (and its directory),
+// and write the default configuration keys. The file is automatically chmodded to 0600,
+// to prevent world readable permissions (it stores a plaintext password). When the
+// file was created, a ConfigCreatedError is returned, since the defaults need to be
+// edited before they're of any use. The settings are decoded, see NewConfig.
+func ReadConfiguration(configFile string) (Config, error) {
+	configFilePath := path.Dir(configFile)
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		// If it doesn't exist, or the like, create it. First, create the directories
+		// required, if necessary.
+		if os.MkdirAll(configFilePath, 0700) != nil {
+			return Config{}, fmt.Errorf("Failed to create configuration directory `%s'", configFilePath)
+		}
+		slog.Info("Creating default configuration file", "file", configFile)
+		file, err = os.Create(configFile)
+		if err != nil {
+			// We need a config file, so Exit(1) when it failed.
+			return Config{}, fmt.Errorf("Failed to create configuration file `%s'\n", configFile)
+		}
+		// change permissions to be r/w to current user only. This file is
+		// storing a plain text password, so we must not make it world readable.
+		if err = file.Chmod(0600); err != nil {
+			return Config{}, fmt.Errorf("Failed to change permissions on configuration file `%s'\n", configFile)
+		}
+
+		defer file.Close()
+
+		// write some default settings:
+		settings := DefaultSettings()
+
+		if err = saveSettingsFile(configFile, settings); err != nil {
+			return Config{}, fmt.Errorf("Unable to write to configuration file.")
+		}
+
+		// the environment may provide what the placeholders lack, like
+		// in containers where mounting a configuration file is awkward.
+		if applyEnvOverrides(settings) == 0 {
+			return Config{}, &ConfigCreatedError{configFile}
+		}
+		return NewConfig(settings)
+	}
+	file.Close()
+
+	// If the file does exist though, read the properties:
+	settings, err := loadSettingsFile(configFile)
+	if err != nil {
+		return Config{}, err
+	}
+	applyEnvOverrides(settings)
+
+	return NewConfig(settings)
+}
+
+// Returns the name of the environment variable overriding the given setting,
+// which is the setting in upper case prefixed with STATS_. For example, the
+// MailHost setting is overridden by STATS_MAILHOST.
+func EnvVarName(setting string) string {
+	return "STATS_" + strings.ToUpper(setting)
+}
+
+// Overrides the settings with the environment variables which are set, see
+// EnvVarName. Environment variables win over both the configuration file and
+// the defaults, so secrets like the password need not be stored on disk.
+// Returns the amount of overridden settings.
+func applyEnvOverrides(settings map[string]string) int {
+	overridden := 0
+	for _, setting := range allSettings {
+		if val, ok := os.LookupEnv(EnvVarName(setting)); ok {
+			settings[setting] = val
+			overridden++
+		}
+	}
+
+	return overridden
+}
+
+// Gets a duration setting from the settings map, in the format understood by
+// time.ParseDuration (e.g. `30s', `5m'). Returns def when the setting is absent
+// or empty, and an error when it cannot be parsed.
+func SettingDuration(settings map[string]string, key string, def time.Duration) (time.Duration, error) {
+	val := strings.TrimSpace(settings[key])
+	if val == "" {
+		return def, nil
+	}
+
+	dur, err := time.ParseDuration(val)
+	if err != nil {
+		return def, fmt.Errorf("Invalid duration `%s' for setting %s: %s", val, key, err)
+	}
+
+	return dur, nil
+}
+
+// Gets an integer setting from the settings map. Returns def when the setting
+// is absent or empty, and an error when it's not a number.
+func SettingInt(settings map[string]string, key string, def int) (int, error) {
+	val := strings.TrimSpace(settings[key])
+	if val == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return def, fmt.Errorf("Invalid number `%s' for setting %s", val, key)
+	}
+
+	return i, nil
+}
+
+// Gets a boolean setting from the settings map, accepting the values
+// understood by strconv.ParseBool (true, false, 1, 0, ...). Returns def when
+// the setting is absent or empty, and an error when it can't be parsed.
+func SettingBool(settings map[string]string, key string, def bool) (bool, error) {
+	val := strings.TrimSpace(settings[key])
+	if val == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return def, fmt.Errorf("Invalid boolean `%s' for setting %s", val, key)
+	}
+
+	return b, nil
+}
+
+// Gets a comma separated list setting from the settings map. Surrounding
+// whitespace of every element is trimmed, and empty elements are dropped.
+// Returns def when the setting is absent or contains no elements at all.
+func SettingList(settings map[string]string, key string, def []string) []string {
+	list := make([]string, 0)
+	for _, elem := range strings.Split(settings[key], ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+
+	if len(list) == 0 {
+		return def
+	}
+
+	return list
+}
+
+// Returns a random duration between zero and max. Used to spread the load of
+// many hosts running at the same moment (e.g. the same cron minute) on shared
+// services like the external IP providers and the SMTP relay.
+func Jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,445 @@
+package stats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDfOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    []FsEntry
+		wantErr bool
+	}{
+		{
+			name:    "no output",
+			out:     "",
+			wantErr: true,
+		},
+		{
+			name: "header only",
+			out:  "Filesystem      Size  Used Avail Use% Mounted on\n",
+			want: []FsEntry{},
+		},
+		{
+			name: "GNU df -h",
+			out: "Filesystem      Size  Used Avail Use% Mounted on\n" +
+				"/dev/sda1        20G  5.0G   14G  27% /\n" +
+				"tmpfs           1.0G     0  1.0G   0% /run\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/sda1", Size: "20G", Used: "5.0G", Avail: "14G", UsePercentage: "27%", MountPoint: "/",
+					SizeBytes: 20 << 30, UsedBytes: 5 << 30, AvailBytes: 14 << 30},
+				{FileSystem: "tmpfs", Size: "1.0G", Used: "0", Avail: "1.0G", UsePercentage: "0%", MountPoint: "/run",
+					SizeBytes: 1 << 30, AvailBytes: 1 << 30},
+			},
+		},
+		{
+			name: "none is skipped",
+			out: "Filesystem      Size  Used Avail Use% Mounted on\n" +
+				"none               0     0     0    - /sys/fs/bpf\n",
+			want: []FsEntry{},
+		},
+		{
+			name: "malformed lines are skipped",
+			out: "Filesystem      Size  Used Avail Use% Mounted on\n" +
+				"df: /mnt/nfs: Stale file handle\n" +
+				"/dev/sda1        20G  lots   14G  27% /\n" +
+				"/dev/sdb1        10G    1G    9G  10% /data\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/sdb1", Size: "10G", Used: "1G", Avail: "9G", UsePercentage: "10%", MountPoint: "/data",
+					SizeBytes: 10 << 30, UsedBytes: 1 << 30, AvailBytes: 9 << 30},
+			},
+		},
+		{
+			name: "wrapped file system name",
+			out: "Filesystem      Size  Used Avail Use% Mounted on\n" +
+				"/dev/mapper/vg-a-very-long-logical-volume-name\n" +
+				"                 50G   25G   25G  50% /home\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/mapper/vg-a-very-long-logical-volume-name", Size: "50G", Used: "25G", Avail: "25G", UsePercentage: "50%", MountPoint: "/home",
+					SizeBytes: 50 << 30, UsedBytes: 25 << 30, AvailBytes: 25 << 30},
+			},
+		},
+		{
+			name: "mount point with spaces",
+			out: "Filesystem      Size  Used Avail Use% Mounted on\n" +
+				"/dev/sdb1       100G   10G   90G  10% /mnt/my disk\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/sdb1", Size: "100G", Used: "10G", Avail: "90G", UsePercentage: "10%", MountPoint: "/mnt/my disk",
+					SizeBytes: 100 << 30, UsedBytes: 10 << 30, AvailBytes: 90 << 30},
+			},
+		},
+		{
+			name: "blocks",
+			out: "Filesystem     1K-blocks    Used Available Use% Mounted on\n" +
+				"/dev/sda1          20000    5000     15000  25% /\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/sda1", Size: "20000", Used: "5000", Avail: "15000", UsePercentage: "25%", MountPoint: "/",
+					SizeBytes: 20000 << 10, UsedBytes: 5000 << 10, AvailBytes: 15000 << 10},
+			},
+		},
+		{
+			name: "type column",
+			out: "Filesystem     Type  Size  Used Avail Use% Mounted on\n" +
+				"/dev/sda1      ext4   20G    5G   15G  25% /\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/sda1", Type: "ext4", Size: "20G", Used: "5G", Avail: "15G", UsePercentage: "25%", MountPoint: "/",
+					SizeBytes: 20 << 30, UsedBytes: 5 << 30, AvailBytes: 15 << 30},
+			},
+		},
+		{
+			name: "GNU df -i",
+			out: "Filesystem      Inodes  IUsed   IFree IUse% Mounted on\n" +
+				"/dev/sda1      1310720 120000 1190720   10% /\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/sda1", Size: "1310720", Used: "120000", Avail: "1190720", UsePercentage: "10%", MountPoint: "/",
+					SizeBytes: 1310720, UsedBytes: 120000, AvailBytes: 1190720},
+			},
+		},
+		{
+			name: "macOS df -h",
+			out: "Filesystem       Size   Used  Avail Capacity iused ifree %iused  Mounted on\n" +
+				"/dev/disk3s1s1  460Gi   10Gi  300Gi     4%  404k  3.1G    0%   /\n" +
+				"map auto_home     0Bi    0Bi    0Bi   100%     0     0     -   /System/Volumes/Data/home\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/disk3s1s1", Size: "460Gi", Used: "10Gi", Avail: "300Gi", UsePercentage: "4%", MountPoint: "/",
+					SizeBytes: 460 << 30, UsedBytes: 10 << 30, AvailBytes: 300 << 30, IUsed: "404k", IFree: "3.1G", IUsePercentage: "0%"},
+				{FileSystem: "map auto_home", Size: "0Bi", Used: "0Bi", Avail: "0Bi", UsePercentage: "100%", MountPoint: "/System/Volumes/Data/home",
+					IUsed: "0", IFree: "0", IUsePercentage: "-"},
+			},
+		},
+		{
+			name: "FreeBSD df",
+			out: "Filesystem  512-blocks    Used   Avail Capacity  Mounted on\n" +
+				"/dev/ada0p2    40000000 8000000 28800000    22%    /\n",
+			want: []FsEntry{
+				{FileSystem: "/dev/ada0p2", Size: "40000000", Used: "8000000", Avail: "28800000", UsePercentage: "22%", MountPoint: "/",
+					SizeBytes: 40000000 * 512, UsedBytes: 8000000 * 512, AvailBytes: 28800000 * 512},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := parseDfOutput([]byte(test.out))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", test.name, got, test.want)
+		}
+	}
+}
+
+// A provider which hangs must not block the report: it times out, and the
+// next provider is tried.
+func TestGetExtIPAddressTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		fmt.Fprintln(w, "192.0.2.1")
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "192.0.2.2")
+	}))
+	defer fast.Close()
+
+	start := time.Now()
+	_, err := GetExtIPAddress(context.Background(), []string{slow.URL}, 100*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected an error from a provider which hangs")
+	}
+	if !strings.Contains(err.Error(), slow.URL) {
+		t.Errorf("expected the provider in the error, got %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected a timeout after 100ms, took %s", elapsed)
+	}
+
+	ip, err := GetExtIPAddress(context.Background(), []string{slow.URL, fast.URL}, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip != "192.0.2.2" {
+		t.Errorf("expected the address of the second provider, got %s", ip)
+	}
+}
+
+// With a plain text body, the message is multipart/alternative: the plain
+// text first, the preferred HTML last.
+func TestBuildMessageAlternative(t *testing.T) {
+	ms := &MailSettings{
+		MailFrom:    "Stats <stats@example.org>",
+		MailTo:      "admin@example.org",
+		MailSubject: "Report",
+		FromAddress: "stats@example.org",
+		Body:        "<p>Uptime: 3 days</p>",
+		TextBody:    "Uptime: 3 days",
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(BuildMessage(ms)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %s", mediaType)
+	}
+
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", ms.TextBody},
+		{"text/html; charset=UTF-8", ms.Body},
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for _, w := range want {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("expected a %s part: %s", w.contentType, err)
+		}
+		if ct := part.Header.Get("Content-Type"); ct != w.contentType {
+			t.Errorf("expected %s, got %s", w.contentType, ct)
+		}
+		body, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != w.body {
+			t.Errorf("expected %q, got %q", w.body, body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("expected two parts only, got %v", err)
+	}
+}
+
+// The headers parse cleanly: a date, a unique message ID in the domain of the
+// envelope sender, the From and To headers as configured, and the Bcc only in
+// the envelope.
+func TestBuildMessageHeaders(t *testing.T) {
+	ms := &MailSettings{
+		MailFrom:    "Server report <stats@example.org>",
+		MailTo:      "Admin <admin@example.org>",
+		MailCc:      "ops@example.org",
+		MailBcc:     "secret@example.org",
+		MailSubject: "Report",
+		FromAddress: "bounces@example.net",
+		Body:        "<p>Report</p>",
+	}
+
+	start := time.Now().Add(-time.Second)
+	msg, err := mail.ReadMessage(bytes.NewReader(BuildMessage(ms)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date, err := msg.Header.Date()
+	if err != nil {
+		t.Errorf("invalid Date header: %s", err)
+	} else if date.Before(start) || date.After(time.Now()) {
+		t.Errorf("expected the current time in the Date header, got %s", date)
+	}
+
+	id := msg.Header.Get("Message-ID")
+	if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.net>") {
+		t.Errorf("expected a message ID in the domain of the envelope sender, got %s", id)
+	}
+	other, err := mail.ReadMessage(bytes.NewReader(BuildMessage(ms)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Header.Get("Message-ID") == id {
+		t.Errorf("expected unique message IDs, got %s twice", id)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "Server report" || from[0].Address != "stats@example.org" {
+		t.Errorf("unexpected From header %q (%v)", msg.Header.Get("From"), err)
+	}
+	to, err := msg.Header.AddressList("To")
+	if err != nil || len(to) != 1 || to[0].Address != "admin@example.org" {
+		t.Errorf("unexpected To header %q (%v)", msg.Header.Get("To"), err)
+	}
+	if cc := msg.Header.Get("Cc"); cc != ms.MailCc {
+		t.Errorf("expected Cc %s, got %s", ms.MailCc, cc)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("expected no Bcc header, got %s", bcc)
+	}
+	if version := msg.Header.Get("MIME-Version"); version != "1.0" {
+		t.Errorf("expected MIME-Version 1.0, got %q", version)
+	}
+}
+
+// Multibyte subjects and bodies, and long lines, come out of a MIME parser
+// exactly as they went in.
+func TestBuildMessageMultibyte(t *testing.T) {
+	subject := "Rapport van café-server: 3 waarschuwingen ⚠"
+	body := "<p>Gebruiker: Jürgen, host: サーバー.example.org</p>\n<pre>" + strings.Repeat("ü", 200) + "</pre>\n"
+	text := "Gebruiker: Jürgen, host: サーバー.example.org\nПривет"
+
+	for _, ms := range []*MailSettings{
+		{MailSubject: subject, Body: body},
+		{MailSubject: subject, Body: body, TextBody: text},
+	} {
+		ms.MailFrom, ms.MailTo, ms.FromAddress = "stats@example.org", "admin@example.org", "stats@example.org"
+		raw := BuildMessage(ms)
+		for i, line := range bytes.Split(raw, []byte("\r\n")) {
+			if len(line) > 998 {
+				t.Errorf("line %d is %d bytes long", i, len(line))
+			}
+			for _, b := range line {
+				if b > 127 {
+					t.Fatalf("line %d has 8 bit data: %q", i, line)
+				}
+			}
+		}
+
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if err != nil || decoded != subject {
+			t.Errorf("expected subject %q, got %q (%v)", subject, decoded, err)
+		}
+
+		bodies := make(map[string]string)
+		mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mediaType == "multipart/alternative" {
+			mr := multipart.NewReader(msg.Body, params["boundary"])
+			for {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				content, _ := ioutil.ReadAll(part)
+				bodies[part.Header.Get("Content-Type")] = string(content)
+			}
+		} else {
+			if cte := msg.Header.Get("Content-Transfer-Encoding"); cte != "quoted-printable" {
+				t.Fatalf("expected a quoted-printable body, got %q", cte)
+			}
+			content, _ := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+			bodies[msg.Header.Get("Content-Type")] = string(content)
+		}
+
+		// the line breaks of text are CRLF in mail.
+		for contentType, content := range bodies {
+			bodies[contentType] = strings.ReplaceAll(content, "\r\n", "\n")
+		}
+		if got := bodies["text/html; charset=UTF-8"]; got != body {
+			t.Errorf("expected HTML body %q, got %q", body, got)
+		}
+		if ms.TextBody != "" {
+			if got := bodies["text/plain; charset=UTF-8"]; got != text {
+				t.Errorf("expected text body %q, got %q", text, got)
+			}
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1024 * 1024, "1.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+		{1 << 40, "1.0 TiB"},
+		{5<<40 + 512<<30, "5.5 TiB"},
+		{1 << 50, "1.0 PiB"},
+		{math.MaxUint64, "16.0 EiB"},
+	}
+
+	for _, test := range tests {
+		if got := formatBytes(test.n); got != test.want {
+			t.Errorf("formatBytes(%d): expected %s, got %s", test.n, test.want, got)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		dur  time.Duration
+		want string
+	}{
+		{0, "less than a second"},
+		{500 * time.Millisecond, "less than a second"},
+		{time.Second, "1 second"},
+		{3*time.Minute + 12*time.Second, "3 minutes and 12 seconds"},
+		{24 * time.Hour, "1 day"},
+		{90061 * time.Second, "1 day, 1 hour, 1 minute and 1 second"},
+		{2*24*time.Hour + 5*time.Second, "2 days and 5 seconds"},
+	}
+
+	for _, test := range tests {
+		if got := FormatDuration(test.dur); got != test.want {
+			t.Errorf("FormatDuration(%s): expected %q, got %q", test.dur, test.want, got)
+		}
+	}
+}
+
+// A df which hangs, like on an unreachable NFS mount, is killed after the
+// DfTimeout, and the error tells why.
+func TestGetFreeDiskSpaceTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake df is a shell script")
+	}
+	df := filepath.Join(t.TempDir(), "df")
+	// the sleep keeps the output open after the shell is killed.
+	if err := ioutil.WriteFile(df, []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewConfig(map[string]string{
+		SETTING_DF_COMMAND: df,
+		SETTING_DF_TIMEOUT: "200ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	entries, err := GetFreeDiskSpaceFromConfig(context.Background(), cfg)
+	if err == nil {
+		t.Fatalf("expected a timeout, got %v", entries)
+	}
+	if !strings.Contains(err.Error(), "did not finish within 200ms") {
+		t.Errorf("expected the timeout in the error, got %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond+killWaitDelay+time.Second {
+		t.Errorf("expected df to be killed after 200ms, took %s", elapsed)
+	}
+}
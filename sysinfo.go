@@ -0,0 +1,94 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Describes the machine the report is about.
+type SystemInfo struct {
+	Hostname string `json:"hostname"`
+	// Kernel release, e.g. 6.1.0-18-amd64
+	Kernel string `json:"kernel"`
+	// Pretty name of the distribution, e.g. Debian GNU/Linux 12 (bookworm)
+	Distro string `json:"distro"`
+}
+
+// Returns a simple string representation of this struct.
+func (s SystemInfo) String() string {
+	return fmt.Sprintf("%s (%s, kernel %s)", s.Hostname, s.Distro, s.Kernel)
+}
+
+// Gets the hostname, kernel version and distribution of this machine. Parts
+// which can't be found are left empty, only failing to get the hostname is
+// an error.
+func GetSystemInfo() (SystemInfo, error) {
+	info := SystemInfo{}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return info, fmt.Errorf("Unable to get the hostname: %s", err)
+	}
+	info.Hostname = hostname
+	info.Kernel = getKernelVersion()
+	info.Distro = getDistro("/etc/os-release")
+
+	return info, nil
+}
+
+// Gets the kernel release from /proc, or from uname when there's no /proc.
+func getKernelVersion() string {
+	if release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		return strings.TrimSpace(string(release))
+	}
+
+	// Linux version 6.1.0-18-amd64 (debian-kernel@lists.debian.org) ...
+	if version, err := ioutil.ReadFile("/proc/version"); err == nil {
+		if fld := strings.Fields(string(version)); len(fld) >= 3 {
+			return fld[2]
+		}
+	}
+
+	if release, err := exec.Command("uname", "-r").Output(); err == nil {
+		return strings.TrimSpace(string(release))
+	}
+
+	return ""
+}
+
+// Gets the name of the distribution from an os-release file. That's the
+// PRETTY_NAME, or NAME when there's no pretty one. Returns an empty string
+// when the file can't be read.
+func getDistro(osRelease string) string {
+	file, err := os.Open(osRelease)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		// values may be quoted, in shell style.
+		if val, err := strconv.Unquote(kv[1]); err == nil {
+			kv[1] = val
+		} else {
+			kv[1] = strings.Trim(kv[1], `'"`)
+		}
+		values[kv[0]] = kv[1]
+	}
+
+	if values["PRETTY_NAME"] != "" {
+		return values["PRETTY_NAME"]
+	}
+	return values["NAME"]
+}
@@ -0,0 +1,64 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// A systemd unit which failed.
+type SystemdUnit struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// The low-level state, like failed or auto-restart
+	SubState string `json:"sub_state"`
+}
+
+// Returns a simple string representation of this struct.
+func (u SystemdUnit) String() string {
+	return fmt.Sprintf("%s (%s): %s", u.Name, u.SubState, u.Description)
+}
+
+// Gets the failed systemd units from `systemctl --failed'. On boxes without
+// systemd there are no failed units, so an empty list is returned rather than
+// an error.
+func GetFailedUnits(ctx context.Context) ([]SystemdUnit, error) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return nil, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "systemctl", "--failed", "--no-legend", "--plain", "--no-pager")
+	cmd.WaitDelay = killWaitDelay
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list failed units: %s", err)
+	}
+
+	return parseFailedUnits(string(out)), nil
+}
+
+// Parses the output of `systemctl --failed --no-legend --plain', which lists
+// a unit per line like `nginx.service loaded failed failed A high performance
+// web server'. The columns are the unit, its load, active and sub state, and
+// the description.
+func parseFailedUnits(output string) []SystemdUnit {
+	units := make([]SystemdUnit, 0)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		units = append(units, SystemdUnit{
+			Name:        fields[0],
+			SubState:    fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+
+	return units
+}
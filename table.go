@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// ANSI escape codes coloring the rows of the table report. Every row starts
+// with a code of the same length, so the columns still line up.
+const (
+	ansiRed     = "\x1b[31m"
+	ansiYellow  = "\x1b[33m"
+	ansiDefault = "\x1b[39m"
+	ansiReset   = "\x1b[0m"
+)
+
+// Writes the report as aligned tables, for a quick look in a terminal: the
+// system, the alerts, uptime, load and memory, the disk usage and I/O, and
+// the failed logins. With color, alerts and the rows over a threshold are colored with
+// ANSI escape codes, which only makes sense when writing to a terminal.
+func WriteTable(w io.Writer, r *ReportData, color bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(c string, cells ...string) {
+		line := strings.Join(cells, "\t")
+		if color {
+			if c == "" {
+				c = ansiDefault
+			}
+			line = c + line + ansiReset
+		}
+		fmt.Fprintln(tw, line)
+	}
+	severityColor := func(s Severity) string {
+		switch s {
+		case SEVERITY_CRITICAL:
+			return ansiRed
+		case SEVERITY_WARNING:
+			return ansiYellow
+		}
+		return ""
+	}
+
+	row("", "Host:", r.System.Hostname)
+	if r.System.Distro != "" {
+		row("", "System:", r.System.Distro+", kernel "+r.System.Kernel)
+	}
+	if r.Uptime != "" {
+		row("", "Uptime:", r.Uptime)
+	}
+	if r.Load != nil {
+		row("", "Load:", fmt.Sprintf("%.2f %.2f %.2f", r.Load.Load1, r.Load.Load5, r.Load.Load15))
+	}
+	if r.Memory != nil {
+		c := ""
+		if r.HasSwapAlert {
+			c = ansiYellow
+		}
+		row(c, "Memory:", fmt.Sprintf("%s of %s used (%.0f%%), swap %.0f%%", formatBytes(r.Memory.Used()),
+			formatBytes(r.Memory.Total), r.Memory.UsedPercentage(), r.Memory.SwapUsedPercentage()))
+	}
+	if r.ExtIp != "" {
+		row("", "IP:", r.ExtIp)
+	}
+	for _, alert := range r.Alerts {
+		row(severityColor(alert.Severity), "Alert:", fmt.Sprintf("[%s] %s: %s", alert.Severity, alert.Category, alert.Message))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.FreeSpace) > 0 {
+		fmt.Fprintln(w, "\nDisk usage:")
+		row("", "Mount", "Filesystem", "Size", "Used", "Avail", "Use%", "Inodes%")
+		for _, fs := range r.FreeSpace {
+			c := ""
+			if len(DiskAlerts([]FsEntry{fs}, r.DiskThreshold, r.InodeThreshold)) > 0 {
+				c = ansiRed
+			}
+			row(c, fs.MountPoint, fs.FileSystem, fs.Size, fs.Used, fs.Avail, fs.UsePercentage, orDash(fs.IUsePercentage))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(r.DiskIO) > 0 {
+		fmt.Fprintln(w, "\nDisk I/O:")
+		row("", "Device", "Reads/s", "Read/s", "Writes/s", "Written/s", "Busy")
+		for _, d := range r.DiskIO {
+			row("", d.Device, fmt.Sprintf("%.0f", d.ReadIOPS), formatBytes(d.ReadBytes), fmt.Sprintf("%.0f", d.WriteIOPS),
+				formatBytes(d.WriteBytes), fmt.Sprintf("%.0f%%", d.Utilization))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(w, "\nFailed logins:")
+		row("", "IP address", "Failures", "User", "Country", "New")
+		for _, f := range r.Failures {
+			c, isNew := "", ""
+			if f.IsNew {
+				c, isNew = ansiYellow, "new"
+			}
+			row(c, f.IPAddress, fmt.Sprint(f.Failures), orDash(f.TopUsername()), orDash(f.Country), isNew)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w)
+		names := make([]string, 0, len(r.Errors))
+		for name := range r.Errors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s unavailable: %s\n", name, r.Errors[name])
+		}
+	}
+
+	return nil
+}
+
+// Returns the string, or a dash when it's empty, so table cells are never
+// blank.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
@@ -0,0 +1,560 @@
+package stats
+
+// The HTML template the report is rendered with, unless a custom template is
+// configured with the TemplatePath setting. See ReportData for what's
+// available to templates.
+const defaultTemplate = `<html>
+<body>
+    {{ if .Enabled "system" }}{{ with .System }}
+    <h1>{{ .Hostname }}</h1>
+    <p>{{ with .Distro }}{{ . }}, {{ end }}kernel {{ .Kernel }}</p>
+    {{ end }}{{ end }}
+    {{ with .Clock }}<p{{ if $.HasClockAlert }} style="color: red"{{ end }}>{{ T "Clock" }}: {{ . }}</p>{{ end }}
+    {{ with index .Errors "clock" }}<p style="color: gray">{{ T "Clock" }} {{ T "unavailable" }}: {{ . }}</p>{{ end }}
+    {{ if not .PreviousReport.IsZero }}<p{{ if .HasReportGap }} style="color: red"{{ end }}>{{ T "Previous report" }}: {{ duration .SincePreviousReport }} {{ T "ago" }}</p>{{ end }}
+
+    {{ with .Alerts }}
+    <h2>{{ T "Alerts" }}:</h2>
+    <ul>
+        {{ range . }}
+        <li style="color: {{ .Severity.Color }}"><strong>{{ .Severity }}</strong> {{ .Category }}: {{ .Message }}</li>
+        {{ end }}
+    </ul>
+    {{ end }}
+    {{ with index .Errors "systemd" }}<p style="color: gray">{{ T "Systemd units" }} {{ T "unavailable" }}: {{ . }}</p>{{ end }}
+
+    {{ with .Updates }}
+    <h2{{ if .Security }} style="color: red"{{ end }}>{{ T "Updates" }}:</h2>
+    {{ num .Total }} updates available ({{ .Security }} security)
+    {{ end }}
+    {{ with index .Errors "updates" }}
+    <h2>{{ T "Updates" }}:</h2>
+    <p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>
+    {{ end }}
+
+    {{ if .Enabled "uptime" }}
+    <h2>{{ T "Uptime" }}:</h2>
+    {{ .Uptime }}{{ if not .BootTime.IsZero }}, {{ T "booted" }} {{ .BootTime.Format "2006-01-02 15:04:05" }}{{ end }}{{ with index .Errors "uptime" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    {{ end }}
+
+    {{ with index .Errors "temperature" }}
+    <h2>{{ T "Temperature" }}:</h2>
+    <p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>
+    {{ end }}
+    {{ with .Hottest }}
+    <h2>{{ T "Temperature" }}:</h2>
+    <b>{{ printf "%.1f" .Celsius }} &deg;C</b> ({{ .Type }})
+    {{ if gt (len $.Temperatures) 1 }}
+    <ul>
+        {{ range $.Temperatures }}
+        <li>{{ .Type }} ({{ .Zone }}): {{ printf "%.1f" .Celsius }} &deg;C</li>
+        {{ end }}
+    </ul>
+    {{ end }}
+    {{ end }}
+
+    {{ with index .Errors "load" }}
+    <h2>{{ T "Load average" }}:</h2>
+    <p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>
+    {{ end }}
+    {{ with .Load }}
+    <h2>{{ T "Load average" }}:</h2>
+    <table style="width: 350px">
+    <tr>
+        <th style="text-align: left">{{ T "1 min" }}</th>
+        <th style="text-align: left">{{ T "5 min" }}</th>
+        <th style="text-align: left">{{ T "15 min" }}</th>
+        <th style="text-align: left">{{ T "Processes" }}</th>
+    </tr>
+    <tr>
+        <td>{{ printf "%.2f" .Load1 }}</td>
+        <td>{{ printf "%.2f" .Load5 }}</td>
+        <td>{{ printf "%.2f" .Load15 }}</td>
+        <td>{{ if .Total }}{{ .Running }} running / {{ .Total }} total{{ end }}</td>
+    </tr>
+    </table>
+    {{ end }}
+
+    {{ with index .Errors "memory" }}
+    <h2>{{ T "Memory" }}:</h2>
+    <p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>
+    {{ end }}
+    {{ with .Memory }}
+    <h2>{{ T "Memory" }}:</h2>
+    <ul>
+        <li>Memory: {{ bytes .Used }} / {{ bytes .Total }} used ({{ printf "%.0f" .UsedPercentage }}%)</li>
+        <li>Buffers: {{ bytes .Buffers }}, cached: {{ bytes .Cached }}</li>
+        {{ if .SwapTotal }}
+        <li>Swap: {{ bytes .SwapUsed }} / {{ bytes .SwapTotal }} used ({{ printf "%.0f" .SwapUsedPercentage }}%)</li>
+        {{ else }}
+        <li>Swap: none</li>
+        {{ end }}
+    </ul>
+    {{ with .Swaps }}
+    <table style="width: 500px">
+    <tr>
+        <th style="text-align: left">{{ T "Swap" }}</th>
+        <th style="text-align: left">{{ T "Type" }}</th>
+        <th style="text-align: left">{{ T "Used" }}</th>
+        <th style="text-align: left">{{ T "Size" }}</th>
+    </tr>
+    {{ range . }}
+    <tr>
+        <td>{{ .Name }}</td>
+        <td>{{ if .IsZram }}zram{{ else }}{{ .Type }}{{ end }}</td>
+        <td>{{ bytes .Used }} ({{ printf "%.0f" .UsedPercentage }}%)</td>
+        <td>{{ bytes .Size }}</td>
+    </tr>
+    {{ end }}
+    </table>
+    {{ end }}
+    {{ end }}
+
+    {{ with index .Errors "processes" }}
+    <h2>{{ T "Top processes" }}:</h2>
+    <p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>
+    {{ end }}
+    {{ if .TopCPU }}
+    <h2>{{ T "Top processes" }}:</h2>
+    <table style="width: 100%">
+    <tr>
+        <th style="text-align: left">{{ T "By CPU" }}</th>
+        <th style="text-align: left">{{ T "By memory" }}</th>
+    </tr>
+    <tr>
+        <td style="vertical-align: top">
+        {{ range .TopCPU }}
+            {{ .Command }} ({{ .PID }}, {{ .User }}): {{ printf "%.1f" .CPUPercent }}%<br>
+        {{ end }}
+        </td>
+        <td style="vertical-align: top">
+        {{ range .TopMemory }}
+            {{ .Command }} ({{ .PID }}, {{ .User }}): {{ bytes .RSSBytes }}<br>
+        {{ end }}
+        </td>
+    </tr>
+    </table>
+    {{ end }}
+    {{ if .Respawns }}
+    <h2>{{ T "Watched processes" }} ({{ T "last" }} {{ duration .RespawnWindow }}):</h2>
+    {{ range .Respawns }}
+    <span{{ if .CrashLoop }} style="color: red"{{ end }}>{{ .Name }}{{ if .Started.IsZero }} {{ T "not running" }}{{ else }} ({{ .PID }}){{ end }}: {{ T "started" }} {{ len .Starts }}x{{ with .Interval }}, ~{{ duration . }}{{ end }}</span><br>
+    {{ end }}
+    {{ end }}
+
+    {{ if .Enabled "ip" }}
+    <h2>{{ T "External IP address (WAN)" }}:</h2>
+    {{ .ExtIp }}{{ with index .Errors "ip" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    {{ end }}
+
+    {{ if .Enabled "interfaces" }}
+    <h2>{{ T "Network interfaces" }}:</h2>
+    {{ with index .Errors "interfaces" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    <table style="width: 100%">
+    <tr>
+        <th style="text-align: left">{{ T "Interface" }}</th>
+        <th style="text-align: left">{{ T "State" }}</th>
+        <th style="text-align: left">{{ T "Hardware address" }}</th>
+        <th style="text-align: left">{{ T "Addresses" }}</th>
+        <th style="text-align: left">{{ T "Traffic since last report" }}</th>
+    </tr>
+    {{ range .Interfaces }}
+    <tr>
+        <td>{{ .Name }}{{ if .IsLoopback }} (loopback){{ end }}</td>
+        <td>{{ if .IsUp }}up{{ else }}down{{ end }}</td>
+        <td>{{ .HardwareAddr }}</td>
+        <td>{{ range $i, $addr := .Addresses }}{{ if $i }}<br>{{ end }}{{ $addr }}{{ end }}</td>
+        <td>{{ if .HasTraffic }}&darr; {{ bytes .RxDelta }} &uarr; {{ bytes .TxDelta }}{{ end }}</td>
+    </tr>
+    {{ end }}
+    </table>
+    {{ end }}
+
+    {{ if .Enabled "logins" }}
+    <h2>{{ T "Logins" }}{{ with .Window }} ({{ T "last" }} {{ duration . }}){{ end }}:</h2>
+    {{ with index .Errors "logins" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    {{ with .UnfamiliarLogins }}<p style="color: red">{{ . }} login(s) from unfamiliar hosts since the previous report</p>{{ end }}
+    <table style="width: 700px">
+    <tr>
+        <th style="text-align: left">{{ T "User" }}</th>
+        <th style="text-align: left">{{ T "Terminal" }}</th>
+        <th style="text-align: left">{{ T "From" }}</th>
+        <th style="text-align: left">{{ T "Logged in at" }}</th>
+    </tr>
+    {{ range .LoggedIn }}
+    <tr{{ if .Unfamiliar }} style="color: red"{{ end }}>
+        <td>{{ .User }}</td>
+        <td>{{ .TTY }}</td>
+        <td>{{ .Host }}</td>
+        <td>{{ .Time.Format "2006-01-02 15:04:05" }} (still logged in)</td>
+    </tr>
+    {{ end }}
+    {{ range .RecentLogins }}
+    <tr{{ if .Unfamiliar }} style="color: red"{{ end }}>
+        <td>{{ .User }}</td>
+        <td>{{ .TTY }}</td>
+        <td>{{ .Host }}</td>
+        <td>{{ .Time.Format "2006-01-02 15:04:05" }}</td>
+    </tr>
+    {{ end }}
+    </table>
+    {{ end }}
+
+    {{ if .Enabled "sockets" }}
+    <h2>{{ T "Listening ports" }}:</h2>
+    {{ with index .Errors "sockets" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    {{ with .UnexpectedPorts }}<p style="color: red">{{ . }} socket(s) listening on a port which is not allowed</p>{{ end }}
+    <table style="width: 700px">
+    <tr>
+        <th style="text-align: left">{{ T "Protocol" }}</th>
+        <th style="text-align: left">{{ T "Address" }}</th>
+        <th style="text-align: left">{{ T "Port" }}</th>
+        <th style="text-align: left">{{ T "Process" }}</th>
+    </tr>
+    {{ range .Listening }}
+    <tr{{ if .Unexpected }} style="color: red"{{ end }}>
+        <td>{{ .Proto }}</td>
+        <td>{{ .Address }}</td>
+        <td>{{ .Port }}</td>
+        <td>{{ if .Process }}{{ .Process }} ({{ .PID }}){{ end }}</td>
+    </tr>
+    {{ end }}
+    </table>
+    {{ end }}
+
+    {{ if .Enabled "authlog" }}
+    <h2>{{ T "Failed logins" }}{{ with .Window }} ({{ T "last" }} {{ duration . }}){{ end }}:</h2>
+    {{ with .NewFailureCount }}<p style="color: red">{{ . }} new IP address(es) since the previous report</p>{{ end }}
+    {{ if .FailedLoginRateWindow }}<p{{ if .HasLoginSpike }} style="color: red"{{ end }}>{{ num .FailedLoginRate }} {{ T "in the last" }} {{ duration .FailedLoginRateWindow }}</p>{{ end }}
+    {{ with index .Errors "authlog" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    {{ with index .Errors "geoip" }}<p style="color: gray">No locations: {{ . }}</p>{{ end }}
+    <table style="width: 700px">
+    <tr>
+        <th style="text-align: left">{{ T "IP address" }}</th>
+        <th style="text-align: left">{{ T "# of failures" }}</th>
+        <th style="text-align: left">{{ T "Most tried user" }}</th>
+        <th style="text-align: left">{{ T "Location" }}</th>
+    </tr>
+    {{ range .Failures }}
+    <tr>
+        <td>{{ .IPAddress }}{{ with .PTR }} ({{ . }}){{ end }}{{ if .IsNew }} <strong style="color: red">new</strong>{{ end }}</td>
+        <td>{{ num .Failures }}</td>
+        <td>{{ .TopUsername }}</td>
+        <td>{{ .City }}{{ if and .City .Country }}, {{ end }}{{ .Country }}</td>
+    </tr>
+    {{ end }}
+    </table>
+    {{ end }}
+
+    {{ with index .Errors "fail2ban" }}
+    <h2>{{ T "Fail2ban bans" }}:</h2>
+    <p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>
+    {{ end }}
+    {{ with .Fail2ban }}
+    <h2>{{ T "Fail2ban bans" }}:</h2>
+    <table style="width: 500px">
+    <tr>
+        <th style="text-align: left">{{ T "Jail" }}</th>
+        <th style="text-align: left">{{ T "IP address" }}</th>
+        <th style="text-align: left">{{ T "Banned since" }}</th>
+    </tr>
+    {{ range .Active }}
+    <tr>
+        <td>{{ .Jail }}</td>
+        <td>{{ .IPAddress }}</td>
+        <td>{{ .BannedAt.Format "2006-01-02 15:04:05" }}</td>
+    </tr>
+    {{ end }}
+    </table>
+
+    <h3>{{ T "Recent ban actions" }}</h3>
+    <ul>
+        {{ range .Recent }}
+        <li>{{ . }}</li>
+        {{ end }}
+    </ul>
+    {{ end }}
+
+    {{ if .Enabled "df" }}
+    <h3>{{ T "Disk usage" }}</h3>
+    {{ with index .Errors "df" }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    <table style="width: 100%">
+        <thead>
+            <tr>
+                <th style="text-align: left">{{ T "Filesystem" }}</th>
+                <th style="text-align: left">{{ T "Size" }}</th>
+                <th style="text-align: left">{{ T "Used" }}</th>
+                <th style="text-align: left">{{ T "Available" }}</th>
+                <th style="text-align: left">{{ T "Percentage used" }}</th>
+                <th style="text-align: left">{{ T "Inodes used" }}</th>
+                <th style="text-align: left">{{ T "Mount point" }}</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{ range .FreeSpace }}
+            <tr{{ if diskAlert . }} style="color: red"{{ end }}>
+                <td>{{ .FileSystem }}</td>
+                <td>{{ .Size }}</td>
+                <td>{{ .Used }}</td>
+                <td>{{ .Avail }}</td>
+                <td>{{ .UsePercentage }}</td>
+                <td>{{ .IUsePercentage }}</td>
+                <td>{{ .MountPoint }}</td>
+            </tr>
+            {{ end }}
+            {{ if .DiskTotalSize }}
+            <tr style="font-weight: bold">
+                <td>{{ T "Total" }}</td>
+                <td>{{ bytes .DiskTotalSize }}</td>
+                <td>{{ bytes .DiskTotalUsed }}</td>
+                <td></td>
+                <td></td>
+                <td></td>
+                <td></td>
+            </tr>
+            {{ end }}
+        </tbody>
+    </table>
+    {{ end }}
+
+    {{ with .SmartDisks }}
+    <h3>{{ T "Disk health" }}</h3>
+    <table style="width: 100%">
+        <thead>
+            <tr>
+                <th style="text-align: left">{{ T "Device" }}</th>
+                <th style="text-align: left">{{ T "Model" }}</th>
+                <th style="text-align: left">{{ T "Health" }}</th>
+                <th style="text-align: left">{{ T "Reallocated sectors" }}</th>
+                <th style="text-align: left">{{ T "Pending sectors" }}</th>
+                <th style="text-align: left">{{ T "Temperature" }}</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{ range . }}
+            <tr{{ if or (not .Passed) .ReallocatedSectors }} style="color: red"{{ else if .PendingSectors }} style="color: darkorange"{{ end }}>
+                <td>{{ .Device }}</td>
+                <td>{{ .Model }}</td>
+                <td>{{ .Health }}</td>
+                <td>{{ .ReallocatedSectors }}</td>
+                <td>{{ .PendingSectors }}</td>
+                <td>{{ with .Celsius }}{{ . }} &deg;C{{ end }}</td>
+            </tr>
+            {{ end }}
+        </tbody>
+    </table>
+    {{ end }}
+    {{ with index .Errors "smart" }}<p style="color: gray">{{ T "Disk health" }} {{ T "unavailable" }}: {{ . }}</p>{{ end }}
+
+    {{ with .DiskIO }}
+    <h3>{{ T "Disk I/O" }}</h3>
+    <table style="width: 100%">
+        <thead>
+            <tr>
+                <th style="text-align: left">{{ T "Device" }}</th>
+                <th style="text-align: left">{{ T "Reads/s" }}</th>
+                <th style="text-align: left">{{ T "Read" }}</th>
+                <th style="text-align: left">{{ T "Writes/s" }}</th>
+                <th style="text-align: left">{{ T "Written" }}</th>
+                <th style="text-align: left">{{ T "Busy" }}</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{ range . }}
+            <tr>
+                <td>{{ .Device }}</td>
+                <td>{{ printf "%.0f" .ReadIOPS }}</td>
+                <td>{{ bytes .ReadBytes }}/s</td>
+                <td>{{ printf "%.0f" .WriteIOPS }}</td>
+                <td>{{ bytes .WriteBytes }}/s</td>
+                <td>{{ printf "%.0f" .Utilization }}%</td>
+            </tr>
+            {{ end }}
+        </tbody>
+    </table>
+    {{ end }}
+    {{ with index .Errors "diskio" }}<p style="color: gray">{{ T "Disk I/O" }} {{ T "unavailable" }}: {{ . }}</p>{{ end }}
+
+    {{ with .Trends }}
+    <h3>{{ T "Trends" }}</h3>
+    <ul>
+        {{ range . }}
+        <li>{{ .Name }}: {{ . }}</li>
+        {{ end }}
+    </ul>
+    {{ end }}
+
+    {{ with index .Errors "commands" }}<p style="color: gray">{{ T "Custom commands" }} {{ T "unavailable" }}: {{ . }}</p>{{ end }}
+    {{ range .Commands }}
+    <h3>{{ .Label }}</h3>
+    {{ with .Error }}<p style="color: gray">Failed: {{ . }}</p>{{ end }}
+    <pre>{{ .Output }}{{ if .Truncated }}[...]{{ end }}</pre>
+    {{ end }}
+
+    {{ with .LogTails }}
+    <h2>{{ T "Log files" }}:</h2>
+    {{ range . }}
+    <h3>{{ .Label }} <small style="color: gray">{{ .Path }}</small></h3>
+    {{ if .Missing }}<p style="color: gray">{{ T "missing" }}</p>{{ end }}
+    {{ with .Error }}<p style="color: gray">{{ T "Unavailable" }}: {{ . }}</p>{{ end }}
+    {{ with .Output }}<pre>{{ . }}</pre>{{ end }}
+    {{ end }}
+    {{ end }}
+</body>
+</html>`
+
+// The plain text template, mirroring the sections of the HTML template for
+// mail clients which don't show HTML.
+const defaultTextTemplate = `
+{{- if .Enabled "system" }}{{ with .System -}}
+{{ T "System" }}: {{ .Hostname }}{{ with .Distro }}, {{ . }}{{ end }}, kernel {{ .Kernel }}
+
+{{ end }}{{ end -}}
+{{ with .Clock -}}
+{{ if $.HasClockAlert }}!! {{ end }}{{ T "Clock" }}: {{ . }}
+
+{{ end -}}
+{{ with index .Errors "clock" -}}
+{{ T "Clock" }}: {{ T "unavailable" }} — {{ . }}
+
+{{ end -}}
+{{ if not .PreviousReport.IsZero -}}
+{{ if .HasReportGap }}!! {{ end }}{{ T "Previous report" }}: {{ duration .SincePreviousReport }} {{ T "ago" }}
+
+{{ end -}}
+{{- with .Alerts -}}
+{{ T "Alerts" }}:
+{{ range . }}   {{ if eq .Severity.String "critical" }}!! {{ end }}{{ . }}
+{{ end }}
+{{ end -}}
+{{ with index .Errors "systemd" -}}
+{{ T "Systemd units" }}: {{ T "unavailable" }} — {{ . }}
+
+{{ end -}}
+{{ with .Updates -}}
+{{ if .Security }}!! {{ end }}{{ T "Updates" }}: {{ num .Total }} updates available ({{ .Security }} security)
+
+{{ end -}}
+{{ with index .Errors "updates" -}}
+{{ T "Updates" }}: {{ T "unavailable" }} — {{ . }}
+
+{{ end -}}
+{{ if .Enabled "uptime" -}}
+{{ T "Uptime" }}: {{ with index .Errors "uptime" }}{{ T "unavailable" }} — {{ . }}{{ else }}{{ .Uptime }}, {{ T "booted" }} {{ .BootTime.Format "2006-01-02 15:04:05" }}{{ end }}
+{{ end -}}
+{{ with index .Errors "temperature" -}}
+{{ T "Temperature" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ with .Hottest -}}
+{{ T "Temperature" }}: {{ printf "%.1f" .Celsius }} °C ({{ .Type }})
+{{ end -}}
+{{ with index .Errors "load" }}
+{{ T "Load average" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ with .Load }}
+{{ T "Load average" }}: {{ printf "%.2f %.2f %.2f" .Load1 .Load5 .Load15 }} {{ if .Total }}({{ .Running }} running / {{ .Total }} total){{ end }}
+{{ end -}}
+{{ with index .Errors "memory" }}
+{{ T "Memory" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ with .Memory }}
+{{ T "Memory" }}: {{ bytes .Used }} / {{ bytes .Total }} used ({{ printf "%.0f" .UsedPercentage }}%)
+{{ T "Swap" }}: {{ if .SwapTotal }}{{ bytes .SwapUsed }} / {{ bytes .SwapTotal }} used ({{ printf "%.0f" .SwapUsedPercentage }}%){{ else }}{{ T "none" }}{{ end }}
+{{ range .Swaps }}   {{ .Name }} ({{ if .IsZram }}zram{{ else }}{{ .Type }}{{ end }}): {{ bytes .Used }} / {{ bytes .Size }} used ({{ printf "%.0f" .UsedPercentage }}%)
+{{ end -}}
+{{ end -}}
+{{ with index .Errors "processes" }}
+{{ T "Top processes" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ if .TopCPU }}
+{{ T "Top processes by CPU" }}:
+{{ range .TopCPU }}   {{ .Command }} ({{ .PID }}, {{ .User }}): {{ printf "%.1f" .CPUPercent }}%
+{{ end }}
+{{ T "Top processes by memory" }}:
+{{ range .TopMemory }}   {{ .Command }} ({{ .PID }}, {{ .User }}): {{ bytes .RSSBytes }}
+{{ end -}}
+{{ end }}
+{{ if .Respawns -}}
+{{ T "Watched processes" }} ({{ T "last" }} {{ duration .RespawnWindow }}):
+{{ range .Respawns }}   {{ if .CrashLoop }}!! {{ end }}{{ .Name }}{{ if .Started.IsZero }} {{ T "not running" }}{{ else }} ({{ .PID }}){{ end }}: {{ T "started" }} {{ len .Starts }}x{{ with .Interval }}, ~{{ duration . }}{{ end }}
+{{ end }}
+{{ end -}}
+{{ if .Enabled "ip" -}}
+{{ T "External IP address (WAN)" }}: {{ with index .Errors "ip" }}{{ T "unavailable" }} — {{ . }}{{ else }}{{ .ExtIp }}{{ end }}
+
+{{ end -}}
+{{ if .Enabled "interfaces" -}}
+{{ T "Network interfaces" }}:{{ with index .Errors "interfaces" }} {{ T "unavailable" }} — {{ . }}{{ end }}
+{{ range .Interfaces }}   {{ .Name }} ({{ if .IsUp }}up{{ else }}down{{ end }}): {{ range $i, $addr := .Addresses }}{{ if $i }}, {{ end }}{{ $addr }}{{ end }}
+{{ end -}}
+{{ range .Interfaces }}{{ if .HasTraffic }}   {{ .Name }}: ↓ {{ bytes .RxDelta }} ↑ {{ bytes .TxDelta }} since last report
+{{ end }}{{ end }}
+{{ end -}}
+{{ if .Enabled "logins" -}}
+{{ T "Logins" }}{{ with .Window }} ({{ T "last" }} {{ duration . }}){{ end }}:{{ with index .Errors "logins" }} {{ T "unavailable" }} — {{ . }}{{ end }}{{ with .UnfamiliarLogins }} {{ . }} from unfamiliar hosts since the previous report{{ end }}
+{{ range .LoggedIn }}   {{ if .Unfamiliar }}(unfamiliar) {{ end }}{{ .User }} on {{ .TTY }}{{ with .Host }} from {{ . }}{{ end }} since {{ .Time.Format "2006-01-02 15:04:05" }}, {{ T "still logged in" }}
+{{ end -}}
+{{ range .RecentLogins }}   {{ if .Unfamiliar }}(unfamiliar) {{ end }}{{ .User }} on {{ .TTY }}{{ with .Host }} from {{ . }}{{ end }} at {{ .Time.Format "2006-01-02 15:04:05" }}
+{{ end }}
+{{ end -}}
+{{ if .Enabled "sockets" -}}
+{{ T "Listening ports" }}:{{ with index .Errors "sockets" }} {{ T "unavailable" }} — {{ . }}{{ end }}{{ with .UnexpectedPorts }} {{ . }} on a port which is not allowed{{ end }}
+{{ range .Listening }}   {{ if .Unexpected }}(unexpected) {{ end }}{{ . }}
+{{ end }}
+{{ end -}}
+{{ if .Enabled "authlog" -}}
+{{ T "Failed logins" }}{{ with .Window }} ({{ T "last" }} {{ duration . }}){{ end }}:{{ with index .Errors "authlog" }} {{ T "unavailable" }} — {{ . }}{{ end }}{{ with .NewFailureCount }} {{ . }} new IP address(es) since the previous report{{ end }}
+{{ if .FailedLoginRateWindow }}   {{ if .HasLoginSpike }}!! {{ end }}{{ num .FailedLoginRate }} {{ T "in the last" }} {{ duration .FailedLoginRateWindow }}
+{{ end -}}
+{{ range .Failures }}   {{ if .IsNew }}(new) {{ end }}{{ .IPAddress }}{{ with .PTR }} ({{ . }}){{ end }}: {{ num .Failures }}{{ with .TopUsername }}, mostly as {{ . }}{{ end }}{{ with .Country }}, from {{ . }}{{ end }}
+{{ end -}}
+{{ end -}}
+{{ with index .Errors "fail2ban" }}
+{{ T "Fail2ban bans" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ with .Fail2ban }}
+{{ T "Fail2ban bans" }}:
+{{ range .Active }}   [{{ .Jail }}] {{ .IPAddress }} since {{ .BannedAt.Format "2006-01-02 15:04:05" }}
+{{ end -}}
+{{ end }}
+{{ if .Enabled "df" -}}
+{{ T "Disk usage" }}:{{ with index .Errors "df" }} {{ T "unavailable" }} — {{ . }}{{ end }}
+{{ range .FreeSpace }}   {{ .MountPoint }} ({{ .FileSystem }}): {{ .Used }} of {{ .Size }} used ({{ .UsePercentage }}), {{ .Avail }} available{{ with .IUsePercentage }}, {{ . }} of inodes used{{ end }}
+{{ end -}}
+{{ if .DiskTotalSize }}   {{ T "Total" }}: {{ bytes .DiskTotalUsed }} of {{ bytes .DiskTotalSize }} used
+{{ end -}}
+{{ end -}}
+{{ with index .Errors "smart" }}
+{{ T "Disk health" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ with .SmartDisks }}
+{{ T "Disk health" }}:
+{{ range . }}   {{ if or (not .Passed) .ReallocatedSectors }}!! {{ end }}{{ . }}
+{{ end -}}
+{{ end -}}
+{{ with index .Errors "diskio" }}
+{{ T "Disk I/O" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ with .DiskIO }}
+{{ T "Disk I/O" }}:
+{{ range . }}   {{ . }}
+{{ end -}}
+{{ end -}}
+{{ with .Trends }}
+{{ T "Trends" }}:
+{{ range . }}   {{ .Name }}: {{ . }}
+{{ end -}}
+{{ end -}}
+{{ with index .Errors "commands" }}
+{{ T "Custom commands" }}: {{ T "unavailable" }} — {{ . }}
+{{ end -}}
+{{ range .Commands }}
+{{ .Label }}:{{ with .Error }} failed — {{ . }}{{ end }}
+{{ .Output }}{{ if .Truncated }}[...]
+{{ end }}{{ end }}
+{{- with .LogTails }}
+{{ T "Log files" }}:
+{{ range . }}
+{{ .Label }} ({{ .Path }}):{{ if .Missing }} {{ T "missing" }}{{ end }}{{ with .Error }} {{ T "unavailable" }} — {{ . }}{{ end }}
+{{ with .Output }}{{ . }}
+{{ end }}{{ end }}{{ end }}`
@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The temperature of a single thermal zone.
+type ThermalZone struct {
+	// Name of the zone, e.g. thermal_zone0
+	Zone string `json:"zone"`
+	// What the zone measures, e.g. cpu-thermal or x86_pkg_temp
+	Type    string  `json:"type"`
+	Celsius float64 `json:"celsius"`
+}
+
+// Returns a simple string representation of this struct.
+func (z ThermalZone) String() string {
+	return fmt.Sprintf("%s (%s): %.1f °C", z.Type, z.Zone, z.Celsius)
+}
+
+// Gets the temperatures of the thermal zones in /sys/class/thermal. Systems
+// without any thermal zones, like lots of x86 servers, give an empty result
+// without an error. Zones which can't be read (some report an error when the
+// sensor is off) are skipped.
+func GetCPUTemperature() ([]ThermalZone, error) {
+	dirs, err := filepath.Glob("/sys/class/thermal/thermal_zone*")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list thermal zones: %s", err)
+	}
+
+	zones := make([]ThermalZone, 0, len(dirs))
+	for _, dir := range dirs {
+		temp, err := ioutil.ReadFile(filepath.Join(dir, "temp"))
+		if err != nil {
+			continue
+		}
+		// the temperature is in millidegrees Celsius.
+		millis, err := strconv.ParseInt(strings.TrimSpace(string(temp)), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		zone := ThermalZone{Zone: filepath.Base(dir), Celsius: float64(millis) / 1000}
+		if typ, err := ioutil.ReadFile(filepath.Join(dir, "type")); err == nil {
+			zone.Type = strings.TrimSpace(string(typ))
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+// Returns the hottest of the given zones, or nil when there are none.
+func HottestZone(zones []ThermalZone) *ThermalZone {
+	var hottest *ThermalZone
+	for i := range zones {
+		if hottest == nil || zones[i].Celsius > hottest.Celsius {
+			hottest = &zones[i]
+		}
+	}
+
+	return hottest
+}
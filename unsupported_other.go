@@ -0,0 +1,6 @@
+//go:build !windows
+
+package stats
+
+// Every section is supported, even if a box may lack the tools of some.
+var unsupportedSections []string
@@ -0,0 +1,7 @@
+//go:build windows
+
+package stats
+
+// Sections without a Windows implementation, since they read /proc or files
+// like auth.log and utmp, which Windows doesn't have.
+var unsupportedSections = []string{"authlog", "diskio", "load", "memory", "processes", "logins", "sockets"}
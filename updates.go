@@ -0,0 +1,138 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Values for the PackageManager setting. With PACKAGE_MANAGER_AUTO the first
+// package manager found is used.
+const (
+	PACKAGE_MANAGER_AUTO string = "auto"
+	PACKAGE_MANAGER_APT  string = "apt"
+	PACKAGE_MANAGER_DNF  string = "dnf"
+	PACKAGE_MANAGER_YUM  string = "yum"
+	PACKAGE_MANAGER_NONE string = "none"
+)
+
+// The package updates which are available.
+type PackageUpdates struct {
+	// The package manager which was asked, like apt
+	Manager  string `json:"manager"`
+	Total    int    `json:"total"`
+	Security int    `json:"security"`
+}
+
+// Returns a simple string representation of this struct.
+func (p PackageUpdates) String() string {
+	return fmt.Sprintf("%d updates available (%d security)", p.Total, p.Security)
+}
+
+// Gets the available package updates from the given package manager. When the
+// manager is PACKAGE_MANAGER_AUTO, it's detected. Returns nil without an error
+// when there is no supported package manager, or when it's PACKAGE_MANAGER_NONE.
+func GetPackageUpdates(ctx context.Context, manager string) (*PackageUpdates, error) {
+	if manager == PACKAGE_MANAGER_AUTO || manager == "" {
+		manager = detectPackageManager()
+	}
+
+	switch manager {
+	case PACKAGE_MANAGER_APT:
+		return aptUpdates(ctx)
+	case PACKAGE_MANAGER_DNF, PACKAGE_MANAGER_YUM:
+		return rpmUpdates(ctx, manager)
+	case PACKAGE_MANAGER_NONE:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported package manager `%s'", manager)
+}
+
+// Returns the first package manager which is installed, or
+// PACKAGE_MANAGER_NONE when there is none.
+func detectPackageManager() string {
+	for _, candidate := range []struct{ manager, command string }{
+		{PACKAGE_MANAGER_APT, "apt-get"},
+		{PACKAGE_MANAGER_DNF, "dnf"},
+		{PACKAGE_MANAGER_YUM, "yum"},
+	} {
+		if _, err := exec.LookPath(candidate.command); err == nil {
+			return candidate.manager
+		}
+	}
+
+	return PACKAGE_MANAGER_NONE
+}
+
+// Runs the command with the C locale, so its output can be parsed.
+func packageCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.WaitDelay = killWaitDelay
+	return cmd
+}
+
+// Simulates an upgrade with apt-get, which lists every package it would
+// install like `Inst libc6 [2.36-9] (2.36-9+deb12u4 Debian-Security:12/stable-security [amd64])'.
+// Packages coming from a security archive are security updates.
+func aptUpdates(ctx context.Context) (*PackageUpdates, error) {
+	out, err := packageCommand(ctx, "apt-get", "-s", "-q", "upgrade").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to simulate apt-get upgrade: %s", err)
+	}
+
+	updates := &PackageUpdates{Manager: PACKAGE_MANAGER_APT}
+	for _, line := range strings.Split(string(out), "\n") {
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		updates.Total++
+		if strings.Contains(strings.ToLower(line), "-security") {
+			updates.Security++
+		}
+	}
+
+	return updates, nil
+}
+
+// Asks dnf or yum for the updates. `check-update' lists a package per line,
+// and exits with 100 when there are updates; `updateinfo list --security'
+// lists a security advisory per package.
+func rpmUpdates(ctx context.Context, manager string) (*PackageUpdates, error) {
+	out, err := packageCommand(ctx, manager, "-q", "check-update").Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 100) {
+		return nil, fmt.Errorf("Unable to check for updates with %s: %s", manager, err)
+	}
+
+	updates := &PackageUpdates{Manager: manager, Total: countPackageLines(string(out))}
+
+	out, err = packageCommand(ctx, manager, "-q", "updateinfo", "list", "--security").Output()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list security updates with %s: %s", manager, err)
+	}
+	updates.Security = countPackageLines(string(out))
+
+	return updates, nil
+}
+
+// Counts the lines listing a package in the output of dnf or yum. Lines
+// without at least three columns are headers or empty, and the obsoleted
+// packages after `Obsoleting Packages' are already counted as updates.
+func countPackageLines(output string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		if len(strings.Fields(line)) >= 3 {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,21 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Gets the uptime of this box, from the boot time in the kern.boottime
+// sysctl.
+func GetUptime() (time.Duration, error) {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read kern.boottime: %s", err)
+	}
+
+	return time.Since(time.Unix(tv.Unix())), nil
+}
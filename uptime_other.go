@@ -0,0 +1,22 @@
+//go:build !windows && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package stats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Gets the uptime of this box.
+func GetUptime() (time.Duration, error) {
+	ufile, err := ioutil.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read /proc/uptime")
+	}
+
+	uptimestr := strings.Split(string(ufile), " ")
+
+	return time.ParseDuration(uptimestr[0] + "s")
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package stats
+
+import (
+	"golang.org/x/sys/windows"
+	"time"
+)
+
+// Gets the uptime of this box, from GetTickCount64.
+func GetUptime() (time.Duration, error) {
+	return windows.DurationSinceBoot(), nil
+}